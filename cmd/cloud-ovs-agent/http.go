@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/yangjie500/cloud-ovs-agent/internal/admin"
+	"github.com/yangjie500/cloud-ovs-agent/internal/health"
+	"github.com/yangjie500/cloud-ovs-agent/internal/metrics"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/config"
+)
+
+func newHTTPMux(live, ready *health.Checker) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", live.Handler())
+	mux.Handle("/readyz", ready.Handler())
+	return mux
+}
+
+// serveHTTP serves mux on addr until ctx is done. It returns once the
+// listener is open, so a port already in use fails startup.
+func serveHTTP(ctx context.Context, addr string, mux *http.ServeMux) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	serve(ctx, ln, mux)
+	agentLog.Infof("serving HTTP on %s", ln.Addr())
+	return nil
+}
+
+// serveAdmin serves the admin API on its unix socket until ctx is done.
+func serveAdmin(ctx context.Context, cfg config.AdminConfig, srv *admin.Server) error {
+	ln, err := admin.Listen(cfg.Socket, cfg.Group)
+	if err != nil {
+		return err
+	}
+	serve(ctx, ln, srv.Handler())
+	agentLog.Infof("serving admin API on %s", cfg.Socket)
+	return nil
+}
+
+func serve(ctx context.Context, ln net.Listener, h http.Handler) {
+	srv := &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: 5 * time.Second,
+		// Requests share ctx so long-lived ones, like event streams, end on
+		// shutdown instead of holding it up.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			agentLog.Errorf("HTTP server on %s stopped: %v", ln.Addr(), err)
+		}
+	}()
+}
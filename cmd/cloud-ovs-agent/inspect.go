@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yangjie500/cloud-ovs-agent/internal/inspect"
+	"github.com/yangjie500/cloud-ovs-agent/internal/netdev"
+	"github.com/yangjie500/cloud-ovs-agent/internal/ovs"
+	"github.com/yangjie500/cloud-ovs-agent/internal/sb"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/adminapi"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/config"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+)
+
+// inspectTimeout bounds status and explain, including connecting to OVSDB
+// in direct mode.
+const inspectTimeout = 30 * time.Second
+
+// inspector is served by the running agent (*adminapi.Client) or, in direct
+// mode, by an *inspect.Inspector of the command's own.
+type inspector interface {
+	Bindings(ctx context.Context) ([]adminapi.Binding, error)
+	Explain(ctx context.Context, logicalPort string) (adminapi.Explanation, error)
+}
+
+// inspectFunc prints its findings to stdout and returns the exit code.
+type inspectFunc func(ctx context.Context, in inspector, stdout io.Writer) (int, error)
+
+// inspectCommand runs status or explain against the agent on the admin
+// socket, or directly against OVSDB and netlink if direct is set or no agent
+// answers.
+func inspectCommand(src config.Source, direct bool, logicalPort string, stdout, stderr io.Writer, fn inspectFunc) int {
+	cfg, err := src.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid configuration: %v\n", err)
+		return exitError
+	}
+	// Keep connection chatter out of the output.
+	logger.SetLevel(logger.LevelWarn)
+	if src.LogLevel != "" {
+		logger.SetLevel(logger.ParseLevel(src.LogLevel))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, inspectTimeout)
+	defer cancel()
+
+	var in inspector
+	if !direct && cfg.Admin.Socket != "" {
+		if agentListening(cfg.Admin.Socket) {
+			in = adminapi.New(cfg.Admin.Socket)
+		} else {
+			fmt.Fprintf(stderr, "no agent on %s; reading OVSDB and netlink directly\n", cfg.Admin.Socket)
+		}
+	}
+	if in == nil {
+		dir, closeFn, err := directInspector(ctx, cfg, logicalPort)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		defer closeFn()
+		in = dir
+	}
+
+	code, err := fn(ctx, in, stdout)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return code
+}
+
+func agentListening(socket string) bool {
+	c, err := net.DialTimeout("unix", socket, time.Second)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
+
+// directInspector connects to the local Open_vSwitch DB, the Southbound DB
+// and netlink the way the agent does. It only monitors the Port_Bindings
+// requested on this chassis, or just logicalPort if it is set.
+func directInspector(ctx context.Context, cfg config.Config, logicalPort string) (*inspect.Inspector, func(), error) {
+	if cfg.Agent.Standalone {
+		return nil, nil, errors.New("agent.standalone is set: there is no Southbound DB to inspect")
+	}
+	ovsRemote, err := ovsEndpoint(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	ovsCli, err := ovs.ConnectOVS(ctx, ovsRemote)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OVS connect failed: %w", err)
+	}
+
+	sbRemotes, sbOpts, err := southbound(cfg)
+	if err != nil {
+		ovsCli.Close()
+		return nil, nil, err
+	}
+	sbCli, err := sb.ConnectSouthBoundFor(ctx, sbRemotes, cfg.Agent.Chassis, logicalPort, sbOpts...)
+	if err != nil {
+		ovsCli.Close()
+		return nil, nil, fmt.Errorf("SB connect failed: %w", err)
+	}
+
+	nd, err := netdev.NewManager(cfg.Netdev.Netns)
+	if err != nil {
+		sbCli.Close()
+		ovsCli.Close()
+		return nil, nil, fmt.Errorf("netdev init failed: %w", err)
+	}
+
+	in := &inspect.Inspector{
+		SbCli:   sbCli,
+		OvsCli:  ovsCli,
+		Netdev:  nd,
+		Chassis: cfg.Agent.Chassis,
+		Bridge:  cfg.OVS.Bridge,
+	}
+	return in, func() {
+		nd.Close()
+		sbCli.Close()
+		ovsCli.Close()
+	}, nil
+}
+
+// status prints every binding requested on this chassis. It exits with
+// exitNotPlugged if any of them is not fully plugged.
+func status(ctx context.Context, in inspector, stdout io.Writer) (int, error) {
+	bindings, err := in.Bindings(ctx)
+	if err != nil {
+		return exitError, fmt.Errorf("status: %w", err)
+	}
+
+	code := exitOK
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LOGICAL PORT\tIFNAME\tKIND\tAGENT\tTAP\tOVS\tOFPORT\tSB CHASSIS\tUP")
+	for _, b := range bindings {
+		up := b.SBUp != nil && *b.SBUp
+		if b.Link != adminapi.LinkUp || (b.OVS != adminapi.OVSAttached && b.OVS != adminapi.OVSBypassed) || !up {
+			code = exitNotPlugged
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			b.LogicalPort, b.IfName, b.Kind, orDash(b.State), b.Link, b.OVS, ofport(b.OFPort), orDash(b.SBChassis), boolOrDash(b.SBUp))
+	}
+	tw.Flush()
+	if len(bindings) == 0 {
+		fmt.Fprintln(stdout, "no ports are requested on this chassis")
+	}
+	return code, nil
+}
+
+// explain prints the decision chain for one port. It exits with
+// exitNotPlugged if the port is not plugged.
+func explain(logicalPort string) inspectFunc {
+	return func(ctx context.Context, in inspector, stdout io.Writer) (int, error) {
+		ex, err := in.Explain(ctx, logicalPort)
+		if err != nil {
+			return exitError, fmt.Errorf("explain: %w", err)
+		}
+
+		if ex.Plugged {
+			fmt.Fprintf(stdout, "%s is plugged (checked by %s)\n\n", ex.LogicalPort, ex.Source)
+		} else {
+			fmt.Fprintf(stdout, "%s is not plugged (checked by %s)\n  %s\n\n", ex.LogicalPort, ex.Source, ex.Summary)
+		}
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		for _, c := range ex.Checks {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", checkMark[c.Result], c.Name, c.Detail)
+		}
+		tw.Flush()
+
+		if !ex.Plugged {
+			return exitNotPlugged, nil
+		}
+		return exitOK, nil
+	}
+}
+
+var checkMark = map[string]string{
+	adminapi.CheckOK:   "ok",
+	adminapi.CheckFail: "FAIL",
+	adminapi.CheckSkip: "-",
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func ofport(p *int) string {
+	if p == nil {
+		return "-"
+	}
+	return strconv.Itoa(*p)
+}
+
+func boolOrDash(b *bool) string {
+	if b == nil {
+		return "-"
+	}
+	return strconv.FormatBool(*b)
+}
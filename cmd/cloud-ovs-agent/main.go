@@ -1,47 +1,133 @@
 package main
 
 import (
-	"context"
-	"os/signal"
-	"syscall"
-	"time"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
 
-	"github.com/yangjie500/cloud-ovs-agent/internal/ovs"
-	"github.com/yangjie500/cloud-ovs-agent/internal/sb"
 	"github.com/yangjie500/cloud-ovs-agent/pkg/config"
-	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+	"gopkg.in/yaml.v3"
+)
+
+const usage = `Usage:
+  cloud-ovs-agent [run] [flags]         start the agent (default)
+  cloud-ovs-agent config check [flags]  print the resolved configuration and exit
+  cloud-ovs-agent status [flags]        show every port requested on this chassis
+  cloud-ovs-agent explain [flags] PORT  say why a logical port is or is not plugged
+
+Flags:
+`
+
+// Exit codes.
+const (
+	exitOK    = 0
+	exitError = 1 // invalid configuration or startup failure
+	exitUsage = 2
+
+	exitNotPlugged = 3 // status, explain: a port is not plugged
 )
 
 func main() {
-	cfg, err := config.LoadAll()
-	if err != nil {
-		logger.Errorf("Something wrong loading env var: %v", err)
-		return
+	os.Exit(cli(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func cli(args []string, stdout, stderr io.Writer) int {
+	cmd := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	if cmd == "config" {
+		if len(args) == 0 || args[0] != "check" {
+			fmt.Fprintf(stderr, "unknown config subcommand (want: config check)\n")
+			return exitUsage
+		}
+		cmd, args = "config check", args[1:]
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
+	fs, src := sourceFlags(cmd, stderr)
+	var direct bool
+	if cmd == "status" || cmd == "explain" {
+		fs.BoolVar(&direct, "direct", false, "status, explain: read OVSDB and netlink directly instead of asking the agent")
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	wantArgs := 0
+	if cmd == "explain" {
+		wantArgs = 1
+	}
+	if fs.NArg() != wantArgs {
+		if fs.NArg() < wantArgs {
+			fmt.Fprintf(stderr, "%s needs a logical port\n", cmd)
+		} else {
+			fmt.Fprintf(stderr, "unexpected arguments: %s\n", strings.Join(fs.Args()[wantArgs:], " "))
+		}
+		return exitUsage
+	}
 
-	// Connect to local OVSDB (Open_vSwitch)
-	ovsCli, err := ovs.ConnectOVS(ctx, "unix:/usr/local/var/run/openvswitch/db.sock")
-	if err != nil {
-		logger.Errorf("OVS connect failed: %v", err)
-		return
+	switch cmd {
+	case "run":
+		if err := run(*src); err != nil {
+			agentLog.Errorf("%v", err)
+			return exitError
+		}
+	case "config check":
+		return configCheck(*src, stdout, stderr)
+	case "status":
+		return inspectCommand(*src, direct, "", stdout, stderr, status)
+	case "explain":
+		return inspectCommand(*src, direct, fs.Arg(0), stdout, stderr, explain(fs.Arg(0)))
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", cmd, usage)
+		fs.SetOutput(stderr)
+		fs.PrintDefaults()
+		return exitUsage
 	}
-	defer ovsCli.Close()
+	return exitOK
+}
 
-	// Connect to OVN Southbound (central)
-	sbCli, err := sb.ConnectSouthBound(ctx, "tcp:"+cfg.SouthboundIp+":"+cfg.SouthboundPort)
-	if err != nil {
-		logger.Errorf("SB connect failed: %v", err)
+// sourceFlags registers the flags shared by every command. They override the
+// config file and the environment.
+func sourceFlags(name string, stderr io.Writer) (*flag.FlagSet, *config.Source) {
+	src := &config.Source{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
 	}
-	defer sbCli.Close()
+	fs.StringVar(&src.ConfigPath, "config", "", "YAML config file (default $CONFIG_FILE)")
+	fs.Func("env-file", "dotenv file to read, repeatable; earlier files win (default .env)", func(path string) error {
+		src.EnvFiles = append(src.EnvFiles, path)
+		return nil
+	})
+	fs.StringVar(&src.LogLevel, "log-level", "", "trace | debug | info | warn | error (overrides LOG_LEVEL)")
+	return fs, src
+}
 
-	// Tiny cache warm-up so EnsureInterfaceOnBridge's List/Get uses a populated cache
-	time.Sleep(200 * time.Millisecond)
-	sb.RegisterPBHandler(ctx, sbCli, ovsCli, cfg.HypervisorName, "br-int")
+// configCheck prints the resolved configuration with secrets redacted, or the
+// validation errors, one per line.
+func configCheck(src config.Source, stdout, stderr io.Writer) int {
+	cfg, err := src.Load()
+	if err != nil {
+		fmt.Fprintln(stderr, "configuration invalid:")
+		for _, msg := range strings.Split(err.Error(), "; ") {
+			fmt.Fprintf(stderr, "  %s\n", msg)
+		}
+		return exitError
+	}
 
-	<-ctx.Done()
-	time.Sleep(150 * time.Millisecond)
-	logger.Infof("Exiting...")
+	out, err := yaml.Marshal(cfg.Redacted())
+	if err != nil {
+		fmt.Fprintf(stderr, "encode config: %v\n", err)
+		return exitError
+	}
+	stdout.Write(out)
+	return exitOK
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/yangjie500/cloud-ovs-agent/internal/netdev"
+	"github.com/yangjie500/cloud-ovs-agent/internal/sb"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/config"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+)
+
+var configLog = logger.Named("config")
+
+// agent is the running state a config reload can touch.
+type agent struct {
+	src   config.Source
+	cfg   config.Config
+	links *netdev.LinkWatcher
+	pbw   *sb.PBWatcher
+}
+
+func buildPolicy(cfg config.Config) (sb.Policy, error) {
+	profiles := make(map[string]*netdev.Profile, len(cfg.Netdev.Profiles))
+	for name, p := range cfg.Netdev.Profiles {
+		profile := &netdev.Profile{Name: name, TxQueueLen: p.TxQueueLen, Alias: p.Alias, Offloads: p.Offloads}
+		if err := profile.Validate(); err != nil {
+			return sb.Policy{}, err
+		}
+		profiles[name] = profile
+	}
+	return sb.Policy{
+		MTU:             cfg.Netdev.MTU,
+		Profiles:        profiles,
+		NetworkProfiles: cfg.Netdev.NetworkProfiles,
+	}, nil
+}
+
+// watchReload re-reads the configuration on every SIGHUP until ctx is done.
+func (a *agent) watchReload(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			a.reload()
+		}
+	}
+}
+
+func (a *agent) reload() {
+	configLog.Infof("SIGHUP received, reloading configuration")
+
+	next, err := a.src.Load()
+	if err != nil {
+		configLog.Errorf("reload rejected, keeping running config: %v", err)
+		return
+	}
+
+	if fields := config.RestartRequired(a.cfg, next); len(fields) > 0 {
+		configLog.Errorf("ignoring changes to %s: restart the agent to apply them", strings.Join(fields, ", "))
+		next.Audit = a.cfg.Audit
+		next.Southbound = a.cfg.Southbound
+		next.OVS = a.cfg.OVS
+		next.HTTP = a.cfg.HTTP
+		next.Admin = a.cfg.Admin
+		next.Tracing = a.cfg.Tracing
+		next.Netdev.Netns = a.cfg.Netdev.Netns
+		next.Agent.Chassis = a.cfg.Agent.Chassis
+		next.Agent.Status = a.cfg.Agent.Status
+		next.Agent.StatusInterval = a.cfg.Agent.StatusInterval
+		next.Agent.Standalone = a.cfg.Agent.Standalone
+	}
+
+	if !reflect.DeepEqual(next.Logging, a.cfg.Logging) {
+		logger.Reconfigure(next.Logging)
+		configLog.Infof("logging reconfigured (level=%s levels=%v file=%s stdout=%t)", next.Logging.Level, next.Logging.Levels, next.Logging.File, next.Logging.ToStdout)
+	}
+
+	if next.Netdev.ReconcileInterval != a.cfg.Netdev.ReconcileInterval {
+		a.links.SetReconcileInterval(next.Netdev.ReconcileInterval)
+		configLog.Infof("reconcile interval %s -> %s", a.cfg.Netdev.ReconcileInterval, next.Netdev.ReconcileInterval)
+	}
+
+	if next.Netdev.Repair != a.cfg.Netdev.Repair {
+		a.links.SetRepair(next.Netdev.Repair)
+		configLog.Infof("netdev repair %t -> %t", a.cfg.Netdev.Repair, next.Netdev.Repair)
+	}
+
+	if next.Agent.Workers != a.cfg.Agent.Workers {
+		a.pbw.SetWorkers(next.Agent.Workers)
+		configLog.Infof("workers %d -> %d", a.cfg.Agent.Workers, next.Agent.Workers)
+	}
+
+	if next.Netdev.MTU != a.cfg.Netdev.MTU ||
+		!reflect.DeepEqual(next.Netdev.Profiles, a.cfg.Netdev.Profiles) ||
+		!reflect.DeepEqual(next.Netdev.NetworkProfiles, a.cfg.Netdev.NetworkProfiles) {
+		policy, err := buildPolicy(next)
+		if err != nil {
+			configLog.Errorf("port policy rejected, keeping previous: %v", err)
+			next.Netdev.MTU = a.cfg.Netdev.MTU
+			next.Netdev.Profiles = a.cfg.Netdev.Profiles
+			next.Netdev.NetworkProfiles = a.cfg.Netdev.NetworkProfiles
+		} else {
+			a.pbw.SetPolicy(policy)
+			configLog.Infof("port policy updated (mtu=%d profiles=%d); applies to ports plugged from now on", policy.MTU, len(policy.Profiles))
+		}
+	}
+
+	a.cfg = next
+	configLog.Infof("reload complete")
+}
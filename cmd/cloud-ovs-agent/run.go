@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ovn-kubernetes/libovsdb/client"
+	"github.com/yangjie500/cloud-ovs-agent/internal/admin"
+	"github.com/yangjie500/cloud-ovs-agent/internal/audit"
+	"github.com/yangjie500/cloud-ovs-agent/internal/health"
+	"github.com/yangjie500/cloud-ovs-agent/internal/inspect"
+	"github.com/yangjie500/cloud-ovs-agent/internal/metrics"
+	"github.com/yangjie500/cloud-ovs-agent/internal/netdev"
+	"github.com/yangjie500/cloud-ovs-agent/internal/ovs"
+	"github.com/yangjie500/cloud-ovs-agent/internal/sb"
+	"github.com/yangjie500/cloud-ovs-agent/internal/tracing"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/config"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+)
+
+var agentLog = logger.Named("agent")
+
+// run starts the agent and blocks until SIGINT/SIGTERM.
+func run(src config.Source) error {
+	cfg, err := src.Load()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	defer logger.Init(cfg.Logging).Close()
+	defer audit.Init(cfg.Audit).Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Init(ctx, cfg.Tracing, cfg.Agent.Chassis)
+	if err != nil {
+		return fmt.Errorf("tracing init failed: %w", err)
+	}
+	defer func() {
+		// Flush what is buffered; ctx is already done at this point.
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			agentLog.Warn("flushing traces failed", logger.KeyErr, err)
+		}
+	}()
+
+	// Gates are registered up front so /readyz fails until each step is done.
+	ovsSynced := health.NewGate("initial OVS monitor sync pending")
+	sbSynced := health.NewGate("initial SB monitor sync pending")
+	reconciled := health.NewGate("initial reconcile pending")
+	live, ready := &health.Checker{}, &health.Checker{}
+	ready.Add("ovs_monitor", ovsSynced.Check)
+	ready.Add("sb_monitor", sbSynced.Check)
+	ready.Add("initial_reconcile", reconciled.Check)
+
+	if cfg.HTTP.Listen != "" {
+		if err := serveHTTP(ctx, cfg.HTTP.Listen, newHTTPMux(live, ready)); err != nil {
+			return fmt.Errorf("HTTP listen failed: %w", err)
+		}
+	}
+
+	// Connect to local OVSDB (Open_vSwitch)
+	ovsRemote, err := ovsEndpoint(cfg)
+	if err != nil {
+		return err
+	}
+	ovsCli, err := ovs.ConnectOVS(ctx, ovsRemote)
+	if err != nil {
+		return fmt.Errorf("OVS connect failed: %w", err)
+	}
+	defer ovsCli.Close()
+	ovsSynced.Open()
+	metrics.RegisterConnection("Open_vSwitch", ovsCli.Connected)
+	ready.Add("ovs_connected", health.Connected(ovsCli.Connected))
+	ready.Add("bridge", func(ctx context.Context) error {
+		return ovs.BridgeExists(ctx, ovsCli, cfg.OVS.Bridge)
+	})
+
+	nd, err := netdev.NewManager(cfg.Netdev.Netns)
+	if err != nil {
+		return fmt.Errorf("netdev init failed: %w", err)
+	}
+	defer nd.Close()
+
+	policy, err := buildPolicy(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid netdev profile: %w", err)
+	}
+
+	// Watch managed TAPs for drift made outside the agent
+	links := netdev.NewLinkWatcher(nd, cfg.Netdev.Repair, nil)
+	links.SetReconcileInterval(cfg.Netdev.ReconcileInterval)
+
+	// Plugs need the bridge in the OVS cache; wait for it rather than fail
+	// the first events.
+	if err := ready.Check(ctx, "ovs_monitor", "bridge"); err != nil {
+		agentLog.Info("waiting for OVS", logger.KeyErr, err)
+		if ready.Wait(ctx, "ovs_monitor", "bridge") != nil {
+			return nil // interrupted while waiting
+		}
+	}
+
+	pbw := &sb.PBWatcher{
+		Ctx:     ctx,
+		OvsCli:  ovsCli,
+		Chassis: cfg.Agent.Chassis,
+		Bridge:  cfg.OVS.Bridge,
+		Netdev:  nd,
+		Links:   links,
+
+		Standalone: cfg.Agent.Standalone,
+	}
+	if cfg.Agent.Status && !cfg.Agent.Standalone {
+		pbw.Status = sb.NewStatusPublisher(cfg.Agent.Chassis, cfg.Agent.StatusInterval)
+	}
+	pbw.SetPolicy(policy)
+	pbw.SetWorkers(cfg.Agent.Workers)
+	live.Add("port_workers", pbw.CheckStalled)
+
+	// Drift and repairs show up in the port's history and event stream.
+	links.OnEvent = pbw.OnLinkEvent
+	go links.Run(ctx)
+
+	srv := &admin.Server{PBW: pbw, OvsCli: ovsCli, Netdev: nd}
+	if cfg.Agent.Standalone {
+		// Ports come from the admin API only.
+		agentLog.Info("standalone: not connecting to the Southbound DB")
+		sbSynced.Open()
+	} else {
+		// Connect to OVN Southbound (central); the initial dump plugs the ports
+		// already bound here before ConnectSouthBound returns.
+		sbRemotes, sbOpts, err := southbound(cfg)
+		if err != nil {
+			return err
+		}
+		sbCli, err := sb.ConnectSouthBound(ctx, sbRemotes, pbw, sbOpts...)
+		if err != nil {
+			return fmt.Errorf("SB connect failed: %w", err)
+		}
+		defer sbCli.Close()
+		sbSynced.Open()
+		metrics.RegisterConnection("OVN_Southbound", sbCli.Connected)
+		ready.Add("sb_connected", health.Connected(sbCli.Connected))
+		go pbw.Status.Run(ctx, sbCli)
+
+		srv.Inspect = &inspect.Inspector{
+			SbCli:   sbCli,
+			OvsCli:  ovsCli,
+			Netdev:  nd,
+			Chassis: cfg.Agent.Chassis,
+			Bridge:  cfg.OVS.Bridge,
+			Agent:   pbw.Port,
+		}
+	}
+
+	if cfg.Admin.Socket != "" {
+		if err := serveAdmin(ctx, cfg.Admin, srv); err != nil {
+			return fmt.Errorf("admin socket: %w", err)
+		}
+	}
+
+	go func() {
+		pbw.InitialReconcile()
+		reconciled.Open()
+		agentLog.Info("agent ready")
+	}()
+
+	a := &agent{src: src, cfg: cfg, links: links, pbw: pbw}
+	go a.watchReload(ctx)
+
+	<-ctx.Done()
+	time.Sleep(150 * time.Millisecond)
+	agentLog.Infof("Exiting...")
+	return nil
+}
+
+// ovsEndpoint returns the configured Open_vSwitch remote or the detected
+// local socket.
+func ovsEndpoint(cfg config.Config) (string, error) {
+	if cfg.OVS.Endpoint != "" {
+		return cfg.OVS.Endpoint, nil
+	}
+	ep, err := ovs.DetectEndpoint()
+	if err != nil {
+		return "", fmt.Errorf("OVS endpoint not configured: %w", err)
+	}
+	return ep, nil
+}
+
+// southbound returns the SB remotes and the client options for them.
+func southbound(cfg config.Config) ([]string, []client.Option, error) {
+	endpoints, err := cfg.Southbound.Endpoints()
+	if err != nil {
+		return nil, nil, fmt.Errorf("SB remote invalid: %w", err)
+	}
+	remotes := make([]string, 0, len(endpoints))
+	for _, ep := range endpoints {
+		remotes = append(remotes, ep.String())
+	}
+	opts := []client.Option{client.WithLeaderOnly(cfg.Southbound.LeaderOnly)}
+	if tlsCfg := cfg.Southbound.TLS; tlsCfg.Enabled() {
+		tc, err := sb.NewTLSConfig(sb.TLSFiles{
+			PrivateKey:  tlsCfg.PrivateKey,
+			Certificate: tlsCfg.Certificate,
+			CACert:      tlsCfg.CACert,
+			ServerName:  tlsCfg.ServerName,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("SB TLS setup failed: %w", err)
+		}
+		opts = append(opts, client.WithTLSConfig(tc))
+	}
+	return remotes, opts, nil
+}
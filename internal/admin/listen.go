@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// Listen opens the admin socket at path. The socket is only usable by the
+// agent's user, or also by group's members if group is set; a directory
+// created for it gets matching permissions. A socket left behind by a
+// crashed agent is replaced, one still in use is not.
+func Listen(path, group string) (net.Listener, error) {
+	gid := -1
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return nil, fmt.Errorf("group %s: bad gid %q", group, g.Gid)
+		}
+	}
+
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+		if err := restrict(dir, gid, 0o700, 0o750); err != nil {
+			return nil, err
+		}
+	}
+
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%s is in use, is another agent running?", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := restrict(path, gid, 0o600, 0o660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// restrict gives path mode, or groupMode and group ownership if gid >= 0.
+func restrict(path string, gid int, mode, groupMode os.FileMode) error {
+	if gid >= 0 {
+		if err := os.Chown(path, -1, gid); err != nil {
+			return err
+		}
+		mode = groupMode
+	}
+	return os.Chmod(path, mode)
+}
@@ -0,0 +1,304 @@
+// Package admin serves the local admin API described in pkg/adminapi.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ovn-kubernetes/libovsdb/client"
+	"github.com/yangjie500/cloud-ovs-agent/internal/inspect"
+	"github.com/yangjie500/cloud-ovs-agent/internal/netdev"
+	"github.com/yangjie500/cloud-ovs-agent/internal/ovs"
+	"github.com/yangjie500/cloud-ovs-agent/internal/sb"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/adminapi"
+)
+
+// Server answers admin requests from the watcher's registry, enriched with
+// what OVS, the kernel and the SB cache currently say about each port.
+type Server struct {
+	PBW     *sb.PBWatcher
+	OvsCli  client.Client
+	Netdev  *netdev.Manager
+	Inspect *inspect.Inspector
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/ports", s.listPorts)
+	mux.HandleFunc("GET /v1/ports/{port}", s.getPort)
+	mux.HandleFunc("GET /v1/events", s.listEvents)
+	mux.HandleFunc("GET /v1/events/stream", s.streamEvents)
+	mux.HandleFunc("GET /v1/bindings", s.listBindings)
+	mux.HandleFunc("GET /v1/ports/{port}/explain", s.explain)
+	mux.HandleFunc("POST /v1/reconcile", s.reconcile)
+	mux.HandleFunc("POST /v1/ports/{port}/reconcile", s.reconcile)
+	mux.HandleFunc("POST /v1/ports/{port}/plug", s.plug)
+	mux.HandleFunc("POST /v1/ports/{port}/unplug", s.unplug)
+	return mux
+}
+
+func (s *Server) listPorts(w http.ResponseWriter, r *http.Request) {
+	managed := s.PBW.Ports()
+	out := make([]adminapi.Port, 0, len(managed))
+	for i := range managed {
+		out = append(out, s.port(r.Context(), &managed[i]))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LogicalPort < out[j].LogicalPort })
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) getPort(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("port")
+	mp, ok := s.PBW.Port(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "port "+name+" is not managed by this agent")
+		return
+	}
+	d := adminapi.PortDetail{Port: s.port(r.Context(), &mp), LastError: mp.LastError, History: events(mp.History)}
+	writeJSON(w, http.StatusOK, d)
+}
+
+func (s *Server) listEvents(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, events(s.PBW.Events(limit)))
+}
+
+func (s *Server) listBindings(w http.ResponseWriter, r *http.Request) {
+	if s.Inspect == nil {
+		writeError(w, http.StatusNotImplemented, "a standalone agent has no bindings to inspect")
+		return
+	}
+	out, err := s.Inspect.Bindings(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) explain(w http.ResponseWriter, r *http.Request) {
+	if s.Inspect == nil {
+		writeError(w, http.StatusNotImplemented, "a standalone agent has no bindings to inspect")
+		return
+	}
+	ex, err := s.Inspect.Explain(r.Context(), r.PathValue("port"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, ex)
+}
+
+func (s *Server) reconcile(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("port") // empty for /v1/reconcile
+	res, err := s.PBW.Reconcile(r.Context(), name)
+	switch {
+	case errors.Is(err, sb.ErrPortNotFound):
+		writeError(w, http.StatusNotFound, "port "+name+" is neither bound to this chassis nor managed")
+		return
+	case err != nil:
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, adminapi.Reconciled{Plug: nonNil(res.Plug), Unplug: nonNil(res.Unplug)})
+}
+
+const (
+	defaultWait = 30 * time.Second
+	maxWait     = 10 * time.Minute
+)
+
+func (s *Server) plug(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("port")
+	var req adminapi.PlugRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	timeout, ok := waitTimeout(w, req.Timeout)
+	if !ok {
+		return
+	}
+	done, err := s.PBW.RequestPlug(r.Context(), sb.PortBinding{LogicalPort: name, Datapath: req.Datapath, Options: req.Options})
+	if err != nil {
+		writeRequestError(w, name, err)
+		return
+	}
+	s.await(w, r, name, sb.StatePlugged, done, req.Wait, timeout)
+}
+
+func (s *Server) unplug(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("port")
+	var req adminapi.UnplugRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	timeout, ok := waitTimeout(w, req.Timeout)
+	if !ok {
+		return
+	}
+	done, err := s.PBW.RequestUnplug(r.Context(), name)
+	if err != nil {
+		writeRequestError(w, name, err)
+		return
+	}
+	s.await(w, r, name, sb.StateUnplugged, done, req.Wait, timeout)
+}
+
+// await replies to a plug or unplug request, after its operation has run if
+// wait is set. The operation carries on if the wait times out or the client
+// goes away.
+func (s *Server) await(w http.ResponseWriter, r *http.Request, name string, state sb.PortState, done <-chan error, wait bool, timeout time.Duration) {
+	res := adminapi.PortResult{LogicalPort: name, IfName: netdev.IfName(name), State: adminapi.StateQueued}
+	if !wait {
+		writeJSON(w, http.StatusAccepted, res)
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		res.State = string(state)
+		if err != nil {
+			res.State, res.Error = string(sb.StateFailed), err.Error()
+		} else if state == sb.StatePlugged {
+			if li, err := s.Netdev.LinkInfo(name); err == nil {
+				res.MAC = li.MAC
+			}
+		}
+		writeJSON(w, http.StatusOK, res)
+	case <-timer.C:
+		writeError(w, http.StatusGatewayTimeout, fmt.Sprintf("port %s is not %s after %s; the operation carries on", name, state, timeout))
+	case <-r.Context().Done():
+	}
+}
+
+func waitTimeout(w http.ResponseWriter, v string) (time.Duration, bool) {
+	if v == "" {
+		return defaultWait, true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 || d > maxWait {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("timeout must be a duration between 0 and %s", maxWait))
+		return 0, false
+	}
+	return d, true
+}
+
+func writeRequestError(w http.ResponseWriter, name string, err error) {
+	switch {
+	case errors.Is(err, sb.ErrPortNotFound):
+		writeError(w, http.StatusNotFound, "port "+name+" has no Port_Binding and is not managed")
+	case errors.Is(err, sb.ErrNotRequestedHere), errors.Is(err, sb.ErrStillRequested):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, sb.ErrNotStandalone):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	}
+}
+
+// port fills in the live OVS, link and SB state of mp. Lookups that fail
+// leave their fields empty.
+func (s *Server) port(ctx context.Context, mp *sb.ManagedPort) adminapi.Port {
+	pb := &mp.PortBinding
+	p := adminapi.Port{
+		LogicalPort: pb.LogicalPort,
+		IfName:      mp.IfName,
+		Datapath:    pb.Datapath,
+		PortBinding: pb.UUID,
+		State:       string(mp.State),
+		Since:       mp.Since,
+		Link:        adminapi.LinkUnknown,
+	}
+
+	// plug names the OVS interface after the logical port.
+	if a, err := ovs.LookupAttachment(ctx, s.OvsCli, pb.LogicalPort); err == nil && a != nil {
+		p.OVSPort, p.Bridge, p.OFPort = a.Port, a.Bridge, a.OFPort
+	}
+
+	switch li, err := s.Netdev.LinkInfo(mp.IfName); {
+	case errors.Is(err, netdev.ErrNotFound):
+		p.Link = adminapi.LinkMissing
+	case err == nil:
+		p.Link = adminapi.LinkDown
+		if li.AdminUp {
+			p.Link = adminapi.LinkUp
+		}
+		p.OperState, p.MAC = li.OperState, li.MAC
+	}
+
+	if cur, err := s.PBW.Binding(ctx, pb.LogicalPort); err == nil {
+		if cur.Chassis != nil {
+			p.SBChassis = s.PBW.ChassisName(ctx, *cur.Chassis)
+		}
+		p.SBUp = cur.Up
+	}
+	return p
+}
+
+func events(evs []sb.Event) []adminapi.Event {
+	out := make([]adminapi.Event, 0, len(evs))
+	for _, ev := range evs {
+		out = append(out, event(ev))
+	}
+	return out
+}
+
+func event(ev sb.Event) adminapi.Event {
+	return adminapi.Event{
+		Seq:         ev.Seq,
+		Time:        ev.Time,
+		Type:        string(ev.Type),
+		LogicalPort: ev.LogicalPort,
+		Datapath:    ev.Datapath,
+		Trigger:     ev.Trigger,
+		Detail:      ev.Detail,
+		Error:       ev.Error,
+	}
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// readJSON decodes an optional JSON request body into v.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,131 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yangjie500/cloud-ovs-agent/internal/sb"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/adminapi"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+)
+
+var log = logger.Named("agent")
+
+// streamEvents sends port events as they are recorded, as server-sent events
+// or, with format=ndjson, one JSON object per line. With since, or SSE's
+// Last-Event-ID, the kept events after that sequence number come first. The
+// port and datapath parameters, each repeatable, filter the stream.
+//
+// The stream ends when the client falls too far behind; it can resume from
+// the last sequence number it saw.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var since *uint64
+	v := q.Get("since")
+	if v == "" {
+		v = r.Header.Get("Last-Event-ID")
+	}
+	if v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be a sequence number")
+			return
+		}
+		since = &n
+	}
+
+	var write func(io.Writer, adminapi.Event) error
+	switch format := q.Get("format"); {
+	case format == "ndjson", format == "" && strings.Contains(r.Header.Get("Accept"), "application/x-ndjson"):
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		write = writeNDJSON
+	case format == "", format == "sse":
+		w.Header().Set("Content-Type", "text/event-stream")
+		write = writeSSE
+	default:
+		writeError(w, http.StatusBadRequest, "format must be sse or ndjson")
+		return
+	}
+	match := eventFilter(q["port"], q["datapath"])
+
+	sub := s.PBW.Subscribe(since)
+	defer sub.Close()
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	if sub.Lost {
+		lost := adminapi.Event{Time: time.Now(), Type: adminapi.EventsLost, Error: "the agent no longer has some events after sequence number " + v}
+		if len(sub.Backlog) > 0 {
+			lost.Seq = sub.Backlog[0].Seq - 1
+		}
+		if write(w, lost) != nil {
+			return
+		}
+	}
+	for _, ev := range sub.Backlog {
+		if match(ev) && write(w, event(ev)) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				log.Warn("event stream client fell behind; closing the stream")
+				return
+			}
+			if !match(ev) {
+				continue
+			}
+			if write(w, event(ev)) != nil || rc.Flush() != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// eventFilter matches events of any of ports and any of datapaths; an empty
+// list matches all.
+func eventFilter(ports, datapaths []string) func(sb.Event) bool {
+	set := func(vals []string) map[string]bool {
+		if len(vals) == 0 {
+			return nil
+		}
+		m := make(map[string]bool, len(vals))
+		for _, v := range vals {
+			m[v] = true
+		}
+		return m
+	}
+	portSet, dpSet := set(ports), set(datapaths)
+	return func(ev sb.Event) bool {
+		return (portSet == nil || portSet[ev.LogicalPort]) && (dpSet == nil || dpSet[ev.Datapath])
+	}
+}
+
+func writeSSE(w io.Writer, ev adminapi.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, data)
+	return err
+}
+
+func writeNDJSON(w io.Writer, ev adminapi.Event) error {
+	return json.NewEncoder(w).Encode(ev)
+}
@@ -0,0 +1,153 @@
+// Package audit appends one JSON line per dataplane change the agent makes:
+// device creation and removal, link state and MTU, OVSDB transactions and SB
+// writes. It answers "who removed this TAP and when" and is kept apart from
+// the debug log, with its own rotation.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ovn-kubernetes/libovsdb/ovsdb"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/config"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Actions.
+const (
+	CreateLink    = "create_link"
+	DeleteLink    = "delete_link"
+	RenameLink    = "rename_link"
+	LinkUp        = "link_up"
+	LinkDown      = "link_down"
+	SetMTU        = "set_mtu"
+	ApplyProfile  = "apply_profile"
+	OVSDBTransact = "ovsdb_transact"
+	SBWrite       = "sb_write"
+)
+
+// Trigger is what made the agent act: a Port_Binding event, or its own
+// repair and reconcile loops.
+type Trigger struct {
+	Event       string `json:"event,omitempty"` // add, update, delete, repair, reconcile
+	Reason      string `json:"reason,omitempty"`
+	PortBinding string `json:"pb_uuid,omitempty"`
+	LogicalPort string `json:"logical_port,omitempty"`
+}
+
+type triggerKey struct{}
+
+// WithTrigger attaches t to ctx; changes recorded with the returned context
+// carry it.
+func WithTrigger(ctx context.Context, t Trigger) context.Context {
+	return context.WithValue(ctx, triggerKey{}, t)
+}
+
+func TriggerFrom(ctx context.Context) (Trigger, bool) {
+	t, ok := ctx.Value(triggerKey{}).(Trigger)
+	return t, ok
+}
+
+type Entry struct {
+	Time       time.Time `json:"ts"`
+	Action     string    `json:"action"`
+	Target     string    `json:"target,omitempty"` // device name or database
+	Trigger    *Trigger  `json:"trigger,omitempty"`
+	Outcome    string    `json:"outcome"` // ok or error
+	Error      string    `json:"error,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+	Details    any       `json:"details,omitempty"`
+}
+
+// Transaction is the details of an OVSDB transaction record.
+type Transaction struct {
+	Ops    []ovsdb.Operation       `json:"ops"`
+	Result []ovsdb.OperationResult `json:"result,omitempty"`
+}
+
+var (
+	mu  sync.Mutex
+	out io.WriteCloser // nil = disabled
+	enc *json.Encoder
+)
+
+// Init opens the audit log described by cfg, or disables auditing if no file
+// is set. The returned closer flushes and closes the file.
+func Init(cfg config.AuditConfig) io.Closer {
+	mu.Lock()
+	defer mu.Unlock()
+	if out != nil {
+		out.Close()
+		out, enc = nil, nil
+	}
+	if cfg.File == "" {
+		return closer{}
+	}
+	out = &lumberjack.Logger{
+		Filename:   cfg.File,
+		MaxSize:    cfg.MaxSizeMb,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAgeDays,
+		Compress:   cfg.Compress,
+	}
+	enc = json.NewEncoder(out)
+	return closer{}
+}
+
+type closer struct{}
+
+func (closer) Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if out == nil {
+		return nil
+	}
+	err := out.Close()
+	out, enc = nil, nil
+	return err
+}
+
+// Enabled reports whether records are being written, so callers can skip
+// building expensive details.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return out != nil
+}
+
+// Record appends one change that started at start and ended now with err.
+func Record(ctx context.Context, action, target string, start time.Time, err error, details any) {
+	now := time.Now()
+	e := Entry{
+		Time:       now.UTC(),
+		Action:     action,
+		Target:     target,
+		Outcome:    "ok",
+		DurationMs: float64(now.Sub(start).Microseconds()) / 1000,
+		Details:    details,
+	}
+	if t, ok := TriggerFrom(ctx); ok {
+		e.Trigger = &t
+	}
+	if err != nil {
+		e.Outcome = "error"
+		e.Error = err.Error()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if enc != nil {
+		_ = enc.Encode(e)
+	}
+}
+
+// Do runs fn and records it as action on target.
+func Do(ctx context.Context, action, target string, details any, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	Record(ctx, action, target, start, err, details)
+	return err
+}
@@ -0,0 +1,159 @@
+// Package health serves the agent's liveness (/healthz) and readiness
+// (/readyz) checks as JSON.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds a single HTTP probe; checks read caches, so this is
+// only hit when something is wedged.
+const checkTimeout = 2 * time.Second
+
+// CheckFunc reports why a condition does not hold, or nil if it does.
+type CheckFunc func(ctx context.Context) error
+
+// Checker is a named set of checks that must all pass. Checks may be added
+// while it is being served.
+type Checker struct {
+	mu     sync.RWMutex
+	checks map[string]CheckFunc
+}
+
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checks == nil {
+		c.checks = make(map[string]CheckFunc)
+	}
+	c.checks[name] = fn
+}
+
+type Result struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string            `json:"status"` // "ok" or "fail"
+	Checks map[string]Result `json:"checks"`
+}
+
+func (r Report) OK() bool { return r.Status == "ok" }
+
+// Run evaluates every check.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := make(map[string]CheckFunc, len(c.checks))
+	for name, fn := range c.checks {
+		checks[name] = fn
+	}
+	c.mu.RUnlock()
+
+	rep := Report{Status: "ok", Checks: make(map[string]Result, len(checks))}
+	for name, fn := range checks {
+		if err := fn(ctx); err != nil {
+			rep.Status = "fail"
+			rep.Checks[name] = Result{Error: err.Error()}
+			continue
+		}
+		rep.Checks[name] = Result{OK: true}
+	}
+	return rep
+}
+
+// Wait blocks until the named checks pass or ctx is done, in which case it
+// returns the last check error.
+func (c *Checker) Wait(ctx context.Context, names ...string) error {
+	t := time.NewTicker(250 * time.Millisecond)
+	defer t.Stop()
+	for {
+		err := c.Check(ctx, names...)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), err)
+		case <-t.C:
+		}
+	}
+}
+
+// Check runs the named checks once and returns the first failure.
+func (c *Checker) Check(ctx context.Context, names ...string) error {
+	for _, name := range names {
+		c.mu.RLock()
+		fn, ok := c.checks[name]
+		c.mu.RUnlock()
+		if !ok {
+			return fmt.Errorf("%s: not registered", name)
+		}
+		if err := fn(ctx); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Handler serves the report as JSON: 200 if every check passes, 503 if not.
+func (c *Checker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		rep := c.Run(ctx)
+		w.Header().Set("Content-Type", "application/json")
+		if !rep.OK() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(rep)
+	})
+}
+
+// Gate is a one-way condition such as "initial sync done".
+type Gate struct {
+	pending string
+	once    sync.Once
+	ch      chan struct{}
+}
+
+// NewGate returns a closed gate; pending is reported until Open is called.
+func NewGate(pending string) *Gate {
+	return &Gate{pending: pending, ch: make(chan struct{})}
+}
+
+func (g *Gate) Open() {
+	g.once.Do(func() { close(g.ch) })
+}
+
+func (g *Gate) Done() <-chan struct{} {
+	return g.ch
+}
+
+func (g *Gate) Check(context.Context) error {
+	select {
+	case <-g.ch:
+		return nil
+	default:
+		return errors.New(g.pending)
+	}
+}
+
+// Connected adapts an OVSDB client's Connected method.
+func Connected(connected func() bool) CheckFunc {
+	return func(context.Context) error {
+		if !connected() {
+			return errors.New("session down")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,267 @@
+// Package inspect works out, from the Southbound DB, the Open_vSwitch DB and
+// netlink, whether the ports requested on this chassis are plugged and why
+// not. The agent serves it over the admin API; the status and explain
+// commands run it themselves when no agent answers.
+package inspect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ovn-kubernetes/libovsdb/client"
+	"github.com/yangjie500/cloud-ovs-agent/internal/netdev"
+	"github.com/yangjie500/cloud-ovs-agent/internal/ovs"
+	"github.com/yangjie500/cloud-ovs-agent/internal/sb"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/adminapi"
+)
+
+// Explanation sources.
+const (
+	SourceAgent  = "agent"
+	SourceDirect = "direct"
+)
+
+// Inspector reads its clients' caches; it changes nothing.
+type Inspector struct {
+	SbCli   client.Client
+	OvsCli  client.Client
+	Netdev  *netdev.Manager
+	Chassis string // HYPERVISOR_NAME
+	Bridge  string
+
+	// Agent looks up the agent's own record of a port. It is nil outside the
+	// agent.
+	Agent func(logicalPort string) (sb.ManagedPort, bool)
+}
+
+func (in *Inspector) source() string {
+	if in.Agent != nil {
+		return SourceAgent
+	}
+	return SourceDirect
+}
+
+// linkTypes maps a VIF kind to the netlink type of its device.
+var linkTypes = map[netdev.Kind]string{
+	netdev.KindTap:     "tuntap",
+	netdev.KindMacvtap: "macvtap",
+	netdev.KindIpvlan:  "ipvlan",
+}
+
+// device is what the host has for one port.
+type device struct {
+	kind    netdev.Kind
+	link    netdev.LinkInfo
+	linkErr error
+	attach  *ovs.Attachment
+	ovsErr  error
+}
+
+func (in *Inspector) probe(ctx context.Context, pb *sb.PortBinding) device {
+	var d device
+	d.kind, _ = pb.VifKind()
+	d.link, d.linkErr = in.Netdev.LinkInfo(pb.LogicalPort)
+	if d.kind.AttachesToOVS() {
+		// plug names the OVS interface after the logical port.
+		d.attach, d.ovsErr = ovs.LookupAttachment(ctx, in.OvsCli, pb.LogicalPort)
+	}
+	return d
+}
+
+func (d *device) linkState() string {
+	switch {
+	case errors.Is(d.linkErr, netdev.ErrNotFound):
+		return adminapi.LinkMissing
+	case d.linkErr != nil:
+		return adminapi.LinkUnknown
+	case d.link.AdminUp:
+		return adminapi.LinkUp
+	default:
+		return adminapi.LinkDown
+	}
+}
+
+func (d *device) ovsState(bridge, logicalPort string) string {
+	switch {
+	case !d.kind.AttachesToOVS():
+		return adminapi.OVSBypassed
+	case d.attach == nil || d.attach.Port == "":
+		return adminapi.OVSMissing
+	case d.attach.Bridge != bridge:
+		return adminapi.OVSWrongBridge
+	case d.attach.IfaceID != logicalPort:
+		return adminapi.OVSWrongIfaceID
+	case d.attach.Error != "" || (d.attach.OFPort != nil && *d.attach.OFPort < 0):
+		return adminapi.OVSError
+	}
+	return adminapi.OVSAttached
+}
+
+// Bindings lists every Port_Binding requested on this chassis with the state
+// of its device, its OVS attachment and its SB claim.
+func (in *Inspector) Bindings(ctx context.Context) ([]adminapi.Binding, error) {
+	pbs, err := sb.RequestedOn(ctx, in.SbCli, in.Chassis)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]adminapi.Binding, 0, len(pbs))
+	for i := range pbs {
+		pb := &pbs[i]
+		if pb.Type == "patch" {
+			continue
+		}
+		d := in.probe(ctx, pb)
+		b := adminapi.Binding{
+			LogicalPort: pb.LogicalPort,
+			Datapath:    pb.Datapath,
+			IfName:      netdev.IfName(pb.LogicalPort),
+			Kind:        string(d.kind),
+			Link:        d.linkState(),
+			OVS:         d.ovsState(in.Bridge, pb.LogicalPort),
+			SBUp:        pb.Up,
+		}
+		if d.attach != nil {
+			b.OFPort = d.attach.OFPort
+		}
+		if pb.Chassis != nil {
+			b.SBChassis = sb.ChassisName(ctx, in.SbCli, *pb.Chassis)
+		}
+		if in.Agent != nil {
+			if mp, ok := in.Agent(pb.LogicalPort); ok {
+				b.State = string(mp.State)
+			}
+		}
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LogicalPort < out[j].LogicalPort })
+	return out, nil
+}
+
+// Explain walks the agent's decisions for logicalPort: is there a binding,
+// does the agent handle its type, is it requested on this chassis, and is
+// the device up and attached to the bridge with the right iface-id. The
+// chain stops at the first decision that rules the port out.
+func (in *Inspector) Explain(ctx context.Context, logicalPort string) (adminapi.Explanation, error) {
+	ex := adminapi.Explanation{LogicalPort: logicalPort, Source: in.source()}
+	add := func(name, result, format string, args ...any) {
+		ex.Checks = append(ex.Checks, adminapi.Check{Name: name, Result: result, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	pb, err := sb.FindBinding(ctx, in.SbCli, logicalPort)
+	switch {
+	case errors.Is(err, sb.ErrPortNotFound):
+		add("binding", adminapi.CheckFail, "no Port_Binding with logical_port %q in the Southbound DB", logicalPort)
+		return verdict(ex), nil
+	case err != nil:
+		return ex, err
+	}
+	add("binding", adminapi.CheckOK, "Port_Binding %s on datapath %s", pb.UUID, pb.Datapath)
+
+	kind, kindErr := pb.VifKind()
+	switch {
+	case pb.Type == "patch":
+		add("type", adminapi.CheckFail, "router port (type patch); the agent does not plug these")
+		return verdict(ex), nil
+	case kindErr != nil:
+		add("type", adminapi.CheckFail, "options:vif-kind: %v", kindErr)
+		return verdict(ex), nil
+	}
+	add("type", adminapi.CheckOK, "type %q, device kind %s", pb.Type, kind)
+
+	switch rc := pb.RequestedChassis(); {
+	case rc == "":
+		add("requested-chassis", adminapi.CheckFail, "options:requested-chassis is not set; the agent only plugs ports requested on its chassis")
+		return verdict(ex), nil
+	case rc != in.Chassis:
+		add("requested-chassis", adminapi.CheckFail, "requested on %s, this chassis is %s (HYPERVISOR_NAME)", rc, in.Chassis)
+		return verdict(ex), nil
+	default:
+		add("requested-chassis", adminapi.CheckOK, "requested on %s", rc)
+	}
+
+	if in.Agent != nil {
+		switch mp, ok := in.Agent(logicalPort); {
+		case !ok:
+			add("agent", adminapi.CheckFail, "the agent has not handled this port since it started")
+		case mp.State == sb.StateFailed:
+			add("agent", adminapi.CheckFail, "last plug failed at %s: %s", mp.Since.Format("15:04:05"), mp.LastError)
+		default:
+			add("agent", adminapi.CheckOK, "%s since %s", mp.State, mp.Since.Format("15:04:05"))
+		}
+	}
+
+	d := in.probe(ctx, pb)
+	ifName := netdev.IfName(logicalPort)
+	switch {
+	case errors.Is(d.linkErr, netdev.ErrNotFound):
+		add("device", adminapi.CheckFail, "no device %s", ifName)
+	case d.linkErr != nil:
+		add("device", adminapi.CheckFail, "looking up %s: %v", ifName, d.linkErr)
+	case d.link.Type != linkTypes[kind]:
+		add("device", adminapi.CheckFail, "%s is a %s device, want %s", ifName, d.link.Type, linkTypes[kind])
+	case !d.link.AdminUp:
+		add("device", adminapi.CheckFail, "%s is down", ifName)
+	default:
+		add("device", adminapi.CheckOK, "%s %s is up (oper %s, mac %s, mtu %d)", d.link.Type, ifName, d.link.OperState, d.link.MAC, d.link.MTU)
+	}
+
+	switch {
+	case !kind.AttachesToOVS():
+		add("bridge", adminapi.CheckSkip, "%s devices bypass OVS", kind)
+		add("iface-id", adminapi.CheckSkip, "%s devices bypass OVS", kind)
+	case d.ovsErr != nil:
+		add("bridge", adminapi.CheckFail, "reading Open_vSwitch: %v", d.ovsErr)
+	case d.attach == nil:
+		add("bridge", adminapi.CheckFail, "no Interface %s in Open_vSwitch", logicalPort)
+		add("iface-id", adminapi.CheckSkip, "no Interface")
+	default:
+		a := d.attach
+		switch {
+		case a.Port == "":
+			add("bridge", adminapi.CheckFail, "Interface %s is in no Port", logicalPort)
+		case a.Bridge != in.Bridge:
+			add("bridge", adminapi.CheckFail, "port %s is on bridge %q, want %s", a.Port, a.Bridge, in.Bridge)
+		case a.Error != "":
+			add("bridge", adminapi.CheckFail, "on %s but ovs-vswitchd reports: %s", in.Bridge, a.Error)
+		case a.OFPort == nil:
+			add("bridge", adminapi.CheckFail, "on %s but ovs-vswitchd has not assigned an ofport", in.Bridge)
+		case *a.OFPort < 0:
+			add("bridge", adminapi.CheckFail, "on %s but ofport is %d", in.Bridge, *a.OFPort)
+		default:
+			add("bridge", adminapi.CheckOK, "port %s on %s, ofport %d", a.Port, in.Bridge, *a.OFPort)
+		}
+		if a.IfaceID == logicalPort {
+			add("iface-id", adminapi.CheckOK, "external_ids:iface-id=%s", a.IfaceID)
+		} else {
+			add("iface-id", adminapi.CheckFail, "external_ids:iface-id is %q, want %q; ovn-controller will not bind it", a.IfaceID, logicalPort)
+		}
+	}
+
+	switch {
+	case pb.Chassis == nil:
+		add("sb-claim", adminapi.CheckFail, "no chassis has claimed the port; ovn-controller has not seen the interface")
+	case sb.ChassisName(ctx, in.SbCli, *pb.Chassis) != in.Chassis:
+		add("sb-claim", adminapi.CheckFail, "claimed by %s", sb.ChassisName(ctx, in.SbCli, *pb.Chassis))
+	case pb.Up == nil || !*pb.Up:
+		add("sb-claim", adminapi.CheckFail, "claimed by %s but up is false; flows are not installed yet", in.Chassis)
+	default:
+		add("sb-claim", adminapi.CheckOK, "claimed by %s and up", in.Chassis)
+	}
+	return verdict(ex), nil
+}
+
+// verdict sets whether ex's port is plugged from its checks; the summary is
+// the first failure.
+func verdict(ex adminapi.Explanation) adminapi.Explanation {
+	for _, c := range ex.Checks {
+		if c.Result == adminapi.CheckFail {
+			ex.Summary = c.Name + ": " + c.Detail
+			return ex
+		}
+	}
+	ex.Plugged = true
+	ex.Summary = "plugged"
+	return ex
+}
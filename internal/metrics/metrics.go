@@ -0,0 +1,109 @@
+// Package metrics holds the agent's Prometheus metrics and the /metrics handler.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cloud_ovs_agent"
+
+// Port_Binding event kinds and outcomes. Reconciles, plugs and unplugs
+// requested through the admin API are counted as events of their own.
+const (
+	EventAdd           = "add"
+	EventUpdate        = "update"
+	EventDelete        = "delete"
+	EventReconcile     = "reconcile"
+	EventPlugRequest   = "plug_request"
+	EventUnplugRequest = "unplug_request"
+
+	ResultHandled = "handled"
+	ResultSkipped = "skipped"
+	ResultFailed  = "failed"
+)
+
+// Timed operations.
+const (
+	OpCreateTap       = "create_tap"
+	OpEnsureInterface = "ensure_interface_on_bridge"
+	OpRemoveInterface = "remove_interface_from_bridge"
+	OpPlug            = "plug"
+	OpPublishStatus   = "publish_status"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	pbEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "port_binding_events_total",
+		Help:      "Port_Binding events by kind and outcome; reason says why an event was skipped or which step failed.",
+	}, []string{"event", "result", "reason"})
+
+	opDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of port operations.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14), // 1ms .. ~8s
+	}, []string{"op", "result"})
+
+	managedPorts = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "managed_ports",
+		Help:      "Ports whose devices the agent currently manages.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		pbEvents,
+		opDuration,
+		managedPorts,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the agent's metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// PBEvent counts one Port_Binding event. reason is empty for handled events.
+func PBEvent(event, result, reason string) {
+	pbEvents.WithLabelValues(event, result, reason).Inc()
+}
+
+// ObserveOp records how long op took since start and whether it failed.
+func ObserveOp(op string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	opDuration.WithLabelValues(op, result).Observe(time.Since(start).Seconds())
+}
+
+func SetManagedPorts(n int) {
+	managedPorts.Set(float64(n))
+}
+
+// RegisterConnection exports 1/0 for whether the session to db is up,
+// sampled from connected on every scrape.
+func RegisterConnection(db string, connected func() bool) {
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "ovsdb_connected",
+		Help:        "Whether the OVSDB session is up (1) or down (0).",
+		ConstLabels: prometheus.Labels{"db": db},
+	}, func() float64 {
+		if connected() {
+			return 1
+		}
+		return 0
+	}))
+}
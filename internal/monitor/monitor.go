@@ -0,0 +1,162 @@
+// Package monitor starts libovsdb monitors and waits for the initial dump to
+// reach both the cache and the agent's event handlers.
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ovn-kubernetes/libovsdb/cache"
+	"github.com/ovn-kubernetes/libovsdb/client"
+	"github.com/ovn-kubernetes/libovsdb/model"
+)
+
+// DefaultTimeout bounds the initial monitor request and the delivery of its rows.
+const DefaultTimeout = 30 * time.Second
+
+// Start registers handlers on cli's cache, monitors every table and returns
+// once the initial reply has been applied to the cache and each of its rows
+// has been passed to the handlers. libovsdb delivers events in order, so the
+// handlers see the initial rows as add events before any later change.
+// cli must be connected.
+func Start(ctx context.Context, cli client.Client, timeout time.Duration, handlers ...cache.EventHandler) error {
+	return start(ctx, cli, timeout, func(ctx context.Context) error {
+		_, err := cli.MonitorAll(ctx)
+		return err
+	}, handlers)
+}
+
+// StartTables is Start for only the tables, columns and rows selected by
+// tables, e.g. client.WithConditionalTable.
+func StartTables(ctx context.Context, cli client.Client, timeout time.Duration, tables []client.MonitorOption, handlers ...cache.EventHandler) error {
+	return start(ctx, cli, timeout, func(ctx context.Context) error {
+		_, err := cli.Monitor(ctx, cli.NewMonitor(tables...))
+		return err
+	}, handlers)
+}
+
+func start(ctx context.Context, cli client.Client, timeout time.Duration, monitor func(context.Context) error, handlers []cache.EventHandler) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tc := cli.Cache()
+	if tc == nil {
+		return client.ErrNotConnected
+	}
+	b := &barrier{
+		dbModel:  tc.DatabaseModel(),
+		handlers: handlers,
+		seen:     make(map[string]struct{}),
+		done:     make(chan struct{}),
+	}
+	tc.AddEventHandler(b)
+
+	if err := monitor(ctx); err != nil {
+		return fmt.Errorf("monitor: %w", err)
+	}
+
+	// The reply is in the cache now; wait until the handlers have caught up
+	// with every row it holds.
+	pending := make(map[string]struct{})
+	for _, table := range tc.Tables() {
+		for uuid := range tc.Table(table).RowsShallow() {
+			pending[uuid] = struct{}{}
+		}
+	}
+	b.expect(pending)
+
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("initial dump not delivered (%d of %d rows pending): %w", b.remaining(), len(pending), ctx.Err())
+	}
+}
+
+// barrier forwards events to the handlers and closes done once every row in
+// the initial dump has gone through.
+type barrier struct {
+	dbModel  model.DatabaseModel
+	handlers []cache.EventHandler
+
+	mu      sync.Mutex
+	seen    map[string]struct{} // rows delivered before pending was known
+	pending map[string]struct{} // nil until expect
+	done    chan struct{}
+}
+
+func (b *barrier) expect(pending map[string]struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for uuid := range b.seen {
+		delete(pending, uuid)
+	}
+	b.seen = nil
+	b.pending = pending
+	b.checkLocked()
+}
+
+func (b *barrier) remaining() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+func (b *barrier) delivered(m model.Model) {
+	uuid := b.uuidOf(m)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.pending == nil:
+		b.seen[uuid] = struct{}{}
+	case len(b.pending) > 0:
+		delete(b.pending, uuid)
+		b.checkLocked()
+	}
+}
+
+func (b *barrier) checkLocked() {
+	if b.pending != nil && len(b.pending) == 0 {
+		select {
+		case <-b.done:
+		default:
+			close(b.done)
+		}
+	}
+}
+
+func (b *barrier) uuidOf(m model.Model) string {
+	info, err := b.dbModel.NewModelInfo(m)
+	if err != nil {
+		return ""
+	}
+	uuid, err := info.FieldByColumn("_uuid")
+	if err != nil {
+		return ""
+	}
+	s, _ := uuid.(string)
+	return s
+}
+
+func (b *barrier) OnAdd(table string, m model.Model) {
+	for _, h := range b.handlers {
+		h.OnAdd(table, m)
+	}
+	b.delivered(m)
+}
+
+func (b *barrier) OnUpdate(table string, old, m model.Model) {
+	for _, h := range b.handlers {
+		h.OnUpdate(table, old, m)
+	}
+	b.delivered(m)
+}
+
+func (b *barrier) OnDelete(table string, m model.Model) {
+	for _, h := range b.handlers {
+		h.OnDelete(table, m)
+	}
+	b.delivered(m)
+}
@@ -0,0 +1,68 @@
+package netdev
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Error kinds returned by netdev operations. Match them with errors.Is.
+var (
+	ErrNotFound    = errors.New("link not found")
+	ErrWrongType   = errors.New("link has unexpected type")
+	ErrPermission  = errors.New("operation not permitted")
+	ErrBusy        = errors.New("device busy")
+	ErrExists      = errors.New("link name already in use")
+	ErrUnsupported = errors.New("not supported in this configuration")
+)
+
+// LinkError records a failed operation on a named link and the kind of failure.
+type LinkError struct {
+	Op   string
+	Name string
+	Kind error // one of the Err* values above, or nil if unclassified
+	Err  error
+}
+
+func (e *LinkError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s %s: %v", e.Op, e.Name, e.Kind)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Name, e.Err)
+}
+
+func (e *LinkError) Unwrap() error { return e.Err }
+
+func (e *LinkError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+func linkError(op, name string, err error) error {
+	return &LinkError{Op: op, Name: name, Kind: classify(err), Err: err}
+}
+
+func classify(err error) error {
+	var notFound netlink.LinkNotFoundError
+	if errors.As(err, &notFound) {
+		return ErrNotFound
+	}
+
+	// Also finds the errno inside *os.PathError and *os.SyscallError.
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return nil
+	}
+	switch errno {
+	case syscall.ENODEV, syscall.ENOENT:
+		return ErrNotFound
+	case syscall.EPERM, syscall.EACCES:
+		return ErrPermission
+	case syscall.EBUSY:
+		return ErrBusy
+	case syscall.EEXIST:
+		return ErrExists
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package netdev
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"ENODEV", syscall.ENODEV, ErrNotFound},
+		{"ENOENT", syscall.ENOENT, ErrNotFound},
+		{"EPERM", syscall.EPERM, ErrPermission},
+		{"EACCES", syscall.EACCES, ErrPermission},
+		{"EBUSY", syscall.EBUSY, ErrBusy},
+		{"EEXIST", syscall.EEXIST, ErrExists},
+		{"other errno", syscall.EINVAL, nil},
+		{"syscall error", os.NewSyscallError("TUNSETIFF", syscall.EBUSY), ErrBusy},
+		{"path error", &os.PathError{Op: "open", Path: "/dev/net/tun", Err: syscall.EACCES}, ErrPermission},
+		{"wrapped", fmt.Errorf("add TAP: %w", syscall.EEXIST), ErrExists},
+		{"link not found", netlink.LinkNotFoundError{}, ErrNotFound},
+		{"errno only in the text", errors.New("device or resource busy"), nil},
+		{"nil", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(tt.err); got != tt.want {
+				t.Errorf("classify(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkErrorIs(t *testing.T) {
+	err := fmt.Errorf("plug: %w", linkError("add TAP", "vm1", os.NewSyscallError("TUNSETIFF", syscall.EBUSY)))
+	if !errors.Is(err, ErrBusy) {
+		t.Errorf("%v is not ErrBusy", err)
+	}
+	if errors.Is(err, ErrExists) {
+		t.Errorf("%v is ErrExists", err)
+	}
+	if !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("%v does not unwrap to EBUSY", err)
+	}
+}
@@ -0,0 +1,108 @@
+package netdev
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// offloadCmds maps ethtool -K feature names to the legacy get/set ioctl pair.
+// lro has no dedicated command and is toggled through the device flags.
+var offloadCmds = map[string][2]uint32{
+	"rx":  {unix.ETHTOOL_GRXCSUM, unix.ETHTOOL_SRXCSUM},
+	"tx":  {unix.ETHTOOL_GTXCSUM, unix.ETHTOOL_STXCSUM},
+	"sg":  {unix.ETHTOOL_GSG, unix.ETHTOOL_SSG},
+	"tso": {unix.ETHTOOL_GTSO, unix.ETHTOOL_STSO},
+	"gso": {unix.ETHTOOL_GGSO, unix.ETHTOOL_SGSO},
+	"gro": {unix.ETHTOOL_GGRO, unix.ETHTOOL_SGRO},
+	"lro": {unix.ETHTOOL_GFLAGS, unix.ETHTOOL_SFLAGS},
+}
+
+const ethFlagLRO = 1 << 15
+
+// OffloadNames lists the offload toggles a Profile may set.
+func OffloadNames() []string {
+	names := make([]string, 0, len(offloadCmds))
+	for n := range offloadCmds {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type ethtoolValue struct {
+	cmd  uint32
+	data uint32
+}
+
+type ethtoolIfreq struct {
+	name [unix.IFNAMSIZ]byte
+	data unsafe.Pointer // *ethtoolValue; a pointer so the GC sees it
+	_    [16]byte
+}
+
+// ethtool issues SIOCETHTOOL on a socket opened in the manager's netns.
+func (m *Manager) ethtool(ifName string, val *ethtoolValue) error {
+	return m.inNetns(func() error {
+		fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("ethtool socket: %w", err)
+		}
+		defer unix.Close(fd)
+
+		var ifr ethtoolIfreq
+		copy(ifr.name[:unix.IFNAMSIZ-1], ifName)
+		ifr.data = unsafe.Pointer(val)
+
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCETHTOOL, uintptr(unsafe.Pointer(&ifr)))
+		runtime.KeepAlive(val)
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	})
+}
+
+func (m *Manager) getOffload(ifName, feature string) (bool, error) {
+	cmds, ok := offloadCmds[feature]
+	if !ok {
+		return false, fmt.Errorf("unknown offload %q", feature)
+	}
+	val := ethtoolValue{cmd: cmds[0]}
+	if err := m.ethtool(ifName, &val); err != nil {
+		return false, linkError("get offload "+feature+" on", ifName, err)
+	}
+	if feature == "lro" {
+		return val.data&ethFlagLRO != 0, nil
+	}
+	return val.data != 0, nil
+}
+
+func (m *Manager) setOffload(ifName, feature string, on bool) error {
+	cmds, ok := offloadCmds[feature]
+	if !ok {
+		return fmt.Errorf("unknown offload %q", feature)
+	}
+
+	val := ethtoolValue{cmd: cmds[1]}
+	if feature == "lro" {
+		cur := ethtoolValue{cmd: cmds[0]}
+		if err := m.ethtool(ifName, &cur); err != nil {
+			return linkError("get flags on", ifName, err)
+		}
+		val.data = cur.data &^ ethFlagLRO
+		if on {
+			val.data |= ethFlagLRO
+		}
+	} else if on {
+		val.data = 1
+	}
+
+	if err := m.ethtool(ifName, &val); err != nil {
+		return linkError("set offload "+feature+" on", ifName, err)
+	}
+	return nil
+}
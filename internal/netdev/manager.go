@@ -0,0 +1,97 @@
+package netdev
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+	"golang.org/x/sys/unix"
+)
+
+var log = logger.Named("netdev")
+
+// Manager performs device operations in one network namespace over a single
+// long-lived netlink handle, so sockets are reused instead of opened per call.
+type Manager struct {
+	handle *netlink.Handle
+	ns     netns.NsHandle // closed (netns.None) for the agent's own namespace
+}
+
+// NewManager binds a Manager to the named netns (as created by `ip netns add`)
+// or to a netns file path. An empty name means the agent's own namespace.
+func NewManager(nsName string) (*Manager, error) {
+	if nsName == "" {
+		return NewManagerAt(netns.None())
+	}
+
+	var ns netns.NsHandle
+	var err error
+	if strings.Contains(nsName, "/") {
+		ns, err = netns.GetFromPath(nsName)
+	} else {
+		ns, err = netns.GetFromName(nsName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open netns %s: %w", nsName, err)
+	}
+
+	m, err := NewManagerAt(ns)
+	if err != nil {
+		ns.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// NewManagerAt binds a Manager to an already opened netns handle. The Manager
+// takes ownership of ns and closes it in Close.
+func NewManagerAt(ns netns.NsHandle) (*Manager, error) {
+	h, err := netlink.NewHandleAt(ns, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("netlink handle: %w", err)
+	}
+	log.Debug("manager ready", "netns", ns.String())
+	return &Manager{handle: h, ns: ns}, nil
+}
+
+func (m *Manager) Close() {
+	m.handle.Close()
+	if m.ns.IsOpen() {
+		m.ns.Close()
+	}
+}
+
+// inNetns runs fn with the calling thread switched into the manager's netns.
+// Only needed for operations that are not plain netlink requests, such as
+// TUNSETIFF on /dev/net/tun, which always acts on the caller's namespace.
+func (m *Manager) inNetns(fn func() error) error {
+	if !m.ns.IsOpen() {
+		return fn()
+	}
+
+	runtime.LockOSThread()
+	orig, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("get current netns: %w", err)
+	}
+	defer orig.Close()
+
+	if err := netns.Set(m.ns); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("enter netns %s: %w", m.ns, err)
+	}
+	defer func() {
+		if err := netns.Set(orig); err != nil {
+			// Leave the thread locked so the runtime throws it away.
+			log.Error("failed to restore netns", logger.KeyErr, err)
+			return
+		}
+		runtime.UnlockOSThread()
+	}()
+
+	return fn()
+}
@@ -0,0 +1,134 @@
+package netdev
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// newTestManager returns a Manager bound to a fresh network namespace that
+// goes away with the test. It skips the test unless running as root.
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to create a network namespace")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	orig, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orig.Close()
+
+	ns, err := netns.New() // also switches this thread into ns
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := netns.Set(orig); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManagerAt(ns)
+	if err != nil {
+		ns.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestIfName(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"vm1", "vm1"},
+		{"vm_port_1", "vm-port-1"},
+		{"0123456789abcdefgh", "0123456789abcde"},
+	}
+	for _, tt := range tests {
+		if got := IfName(tt.in); got != tt.want {
+			t.Errorf("IfName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestManagerTap(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+
+	ifName, err := m.CreateTap(ctx, "vm_tap", 9000, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ifName != "vm-tap" {
+		t.Errorf("ifName = %q, want vm-tap", ifName)
+	}
+	info, err := m.LinkInfo("vm_tap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Type != "tuntap" || info.MTU != 9000 || info.AdminUp {
+		t.Errorf("new link = %+v, want a tuntap with mtu 9000 that is down", info)
+	}
+	if _, err := netlink.LinkByName("vm-tap"); err == nil {
+		t.Error("TAP was created outside the manager's netns")
+	}
+
+	// Creating it again adopts the device and applies the new MTU.
+	if _, err := m.CreateTap(ctx, "vm_tap", 1400, true); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := m.LinkInfo("vm_tap"); info.MTU != 1400 {
+		t.Errorf("mtu = %d after re-create, want 1400", info.MTU)
+	}
+
+	if _, err := m.SetLinkUp(ctx, "vm_tap"); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := m.LinkInfo("vm_tap"); !info.AdminUp {
+		t.Error("link is down after SetLinkUp")
+	}
+	if err := m.SetLinkDown(ctx, "vm_tap"); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := m.LinkInfo("vm_tap"); info.AdminUp {
+		t.Error("link is up after SetLinkDown")
+	}
+
+	if err := m.DeleteLink(ctx, "vm_tap"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.LinkInfo("vm_tap"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("LinkInfo after delete: %v, want ErrNotFound", err)
+	}
+	if err := m.DeleteLink(ctx, "vm_tap"); err != nil {
+		t.Errorf("deleting a missing link: %v", err)
+	}
+	if err := m.SetLinkDown(ctx, "vm_tap"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetLinkDown on a missing link: %v, want ErrNotFound", err)
+	}
+}
+
+func TestManagerWrongType(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+
+	if err := m.handle.LinkAdd(&netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "vm-br"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.CreateTap(ctx, "vm_br", 1500, true); !errors.Is(err, ErrWrongType) {
+		t.Errorf("CreateTap over a bridge: %v, want ErrWrongType", err)
+	}
+	if _, err := m.SetLinkUp(ctx, "vm_br"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("SetLinkUp on a bridge: %v, want ErrWrongType", err)
+	}
+	if info, _ := m.LinkInfo("vm_br"); info.Type != "bridge" {
+		t.Errorf("type = %q, want the bridge left in place", info.Type)
+	}
+}
@@ -0,0 +1,125 @@
+package netdev
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/yangjie500/cloud-ovs-agent/internal/audit"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+)
+
+// Profile is a set of device tunables applied after a VIF is created.
+// Zero values leave the corresponding setting untouched.
+type Profile struct {
+	Name       string
+	TxQueueLen int
+	Alias      string          // "{port}" is replaced by the port's base name
+	Offloads   map[string]bool // ethtool -K feature name -> on/off, see OffloadNames
+}
+
+func (p *Profile) Validate() error {
+	if p.TxQueueLen < 0 {
+		return fmt.Errorf("profile %s: negative txqueuelen %d", p.Name, p.TxQueueLen)
+	}
+	for feature := range p.Offloads {
+		if _, ok := offloadCmds[feature]; !ok {
+			return fmt.Errorf("profile %s: unknown offload %q (known: %s)", p.Name, feature, strings.Join(OffloadNames(), ","))
+		}
+	}
+	return nil
+}
+
+func (p *Profile) aliasFor(baseName string) string {
+	return strings.ReplaceAll(p.Alias, "{port}", baseName)
+}
+
+// ApplyProfile brings the device in line with p and returns the settings it
+// had to change. Calling it on a device that already matches is a no-op, so
+// the reconciler uses it to re-apply profiles that have drifted.
+func (m *Manager) ApplyProfile(ctx context.Context, baseName string, p *Profile) ([]string, error) {
+	if p == nil {
+		return nil, nil
+	}
+	start := time.Now()
+	changed, err := m.applyProfile(baseName, p)
+	if len(changed) > 0 || err != nil {
+		audit.Record(ctx, audit.ApplyProfile, sanitizeIfaceName(baseName), start, err, map[string]any{"profile": p.Name, "changed": changed})
+	}
+	return changed, err
+}
+
+func (m *Manager) applyProfile(baseName string, p *Profile) ([]string, error) {
+	ifName := sanitizeIfaceName(baseName)
+
+	link, exists, err := m.getLink(ifName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, &LinkError{Op: "apply profile " + p.Name + " to", Name: ifName, Kind: ErrNotFound}
+	}
+	// Never tune a foreign device that took the name. Offloads are only
+	// managed on TAPs; on macvtap and ipvlan they are bounded by the parent
+	// uplink's features.
+	if !isVifLink(link) {
+		return nil, &LinkError{Op: "apply profile " + p.Name + " to", Name: ifName, Kind: ErrWrongType}
+	}
+	if _, isTap := link.(*netlink.Tuntap); !isTap && len(p.Offloads) > 0 {
+		return nil, &LinkError{Op: "apply profile " + p.Name + " to", Name: ifName, Kind: ErrUnsupported,
+			Err: fmt.Errorf("offloads are only set on tap devices, not %s", link.Type())}
+	}
+	attrs := link.Attrs()
+
+	var changed []string
+	if p.TxQueueLen > 0 && attrs.TxQLen != p.TxQueueLen {
+		if err := m.handle.LinkSetTxQLen(link, p.TxQueueLen); err != nil {
+			return changed, linkError("set txqueuelen on", ifName, err)
+		}
+		changed = append(changed, fmt.Sprintf("txqueuelen %d->%d", attrs.TxQLen, p.TxQueueLen))
+	}
+
+	if alias := p.aliasFor(baseName); alias != "" && attrs.Alias != alias {
+		if err := m.handle.LinkSetAlias(link, alias); err != nil {
+			return changed, linkError("set alias on", ifName, err)
+		}
+		changed = append(changed, fmt.Sprintf("alias %q->%q", attrs.Alias, alias))
+	}
+
+	features := make([]string, 0, len(p.Offloads))
+	for f := range p.Offloads {
+		features = append(features, f)
+	}
+	sort.Strings(features)
+	for _, f := range features {
+		want := p.Offloads[f]
+		cur, err := m.getOffload(ifName, f)
+		if err != nil {
+			return changed, err
+		}
+		if cur == want {
+			continue
+		}
+		if err := m.setOffload(ifName, f, want); err != nil {
+			return changed, err
+		}
+		changed = append(changed, fmt.Sprintf("%s %s", f, onOff(want)))
+	}
+
+	if len(changed) > 0 {
+		log.Info("profile applied", "profile", p.Name, logger.KeyIfname, ifName, "changed", strings.Join(changed, ", "))
+	} else {
+		log.Debug("profile already in effect", "profile", p.Name, logger.KeyIfname, ifName)
+	}
+	return changed, nil
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,86 @@
+package netdev
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestApplyProfile(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+	if _, err := m.CreateTap(ctx, "vm_prof", 1500, true); err != nil {
+		t.Fatal(err)
+	}
+	p := &Profile{
+		Name:       "nfv",
+		TxQueueLen: 2000,
+		Alias:      "vm-{port}",
+		Offloads:   map[string]bool{"gro": false, "gso": false},
+	}
+
+	changed, err := m.ApplyProfile(ctx, "vm_prof", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"txqueuelen 1000->2000", `alias ""->"vm-vm_prof"`, "gro off", "gso off"}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %q, want %q", changed, want)
+	}
+	link, err := m.handle.LinkByName("vm-prof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs := link.Attrs(); attrs.TxQLen != 2000 || attrs.Alias != "vm-vm_prof" {
+		t.Errorf("txqueuelen %d, alias %q after apply", attrs.TxQLen, attrs.Alias)
+	}
+	for _, f := range []string{"gro", "gso"} {
+		if on, err := m.getOffload("vm-prof", f); err != nil || on {
+			t.Errorf("%s = %v, %v after apply, want off", f, on, err)
+		}
+	}
+
+	if changed, err := m.ApplyProfile(ctx, "vm_prof", p); err != nil || len(changed) != 0 {
+		t.Errorf("re-apply changed %q, %v, want nothing", changed, err)
+	}
+
+	// Drift made behind the agent's back is undone.
+	if err := m.setOffload("vm-prof", "gro", true); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := m.ApplyProfile(ctx, "vm_prof", p); err != nil || !reflect.DeepEqual(changed, []string{"gro off"}) {
+		t.Errorf("changed = %q, %v after gro drift, want [gro off]", changed, err)
+	}
+}
+
+func TestApplyProfileRefused(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+	if err := m.handle.LinkAdd(&netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "vm-br"}}); err != nil {
+		t.Fatal(err)
+	}
+	p := &Profile{Name: "nfv", TxQueueLen: 2000}
+
+	if _, err := m.ApplyProfile(ctx, "vm_br", p); !errors.Is(err, ErrWrongType) {
+		t.Errorf("apply to a bridge: %v, want ErrWrongType", err)
+	}
+	if link, _ := m.handle.LinkByName("vm-br"); link.Attrs().TxQLen == 2000 {
+		t.Error("the bridge was tuned")
+	}
+	if _, err := m.ApplyProfile(ctx, "vm_missing", p); !errors.Is(err, ErrNotFound) {
+		t.Errorf("apply to a missing device: %v, want ErrNotFound", err)
+	}
+}
+
+func TestOffloadUnknown(t *testing.T) {
+	var m Manager
+	if _, err := m.getOffload("vm1", "ufo"); err == nil {
+		t.Error("getOffload accepted an unknown feature")
+	}
+	if err := m.setOffload("vm1", "ufo", true); err == nil {
+		t.Error("setOffload accepted an unknown feature")
+	}
+}
@@ -1,13 +1,25 @@
 package netdev
 
 import (
-	"fmt"
+	"context"
+	"net"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/vishvananda/netlink"
+	"github.com/yangjie500/cloud-ovs-agent/internal/audit"
+	"github.com/yangjie500/cloud-ovs-agent/internal/metrics"
+	"github.com/yangjie500/cloud-ovs-agent/internal/tracing"
 	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+	"golang.org/x/sys/unix"
 )
 
+// IfName returns the device name the agent uses for baseName.
+func IfName(baseName string) string {
+	return sanitizeIfaceName(baseName)
+}
+
 func sanitizeIfaceName(name string) string {
 	name = strings.ReplaceAll(name, "_", "-")
 	if len(name) > 15 {
@@ -16,147 +28,229 @@ func sanitizeIfaceName(name string) string {
 	return name
 }
 
-func getLink(name string) (netlink.Link, bool, error) {
-	link, err := netlink.LinkByName(name)
+func (m *Manager) getLink(name string) (netlink.Link, bool, error) {
+	link, err := m.handle.LinkByName(name)
 	if err != nil {
-		logger.Debugf("[netdev] getlink(%s) -> not found", name)
-		return nil, false, nil
+		if classify(err) == ErrNotFound {
+			log.Debug("getlink: not found", logger.KeyIfname, name)
+			return nil, false, nil
+		}
+		log.Debug("getlink failed", logger.KeyIfname, name, logger.KeyErr, err)
+		return nil, false, linkError("lookup link", name, err)
 	}
-	logger.Debugf("[netdev] getLink(%s) -> found (type=%T)", name, link)
+	log.Debug("getlink: found", logger.KeyIfname, name, "type", link.Type())
 	return link, true, nil
 }
 
-func ensureMTU(link netlink.Link, mtu int) error {
+func (m *Manager) ensureMTU(ctx context.Context, link netlink.Link, mtu int) error {
 	if mtu <= 0 {
 		return nil
 	}
 
 	current := link.Attrs().MTU
 	if current == mtu {
-		logger.Debugf("[netdev] MTU already %d for %s", mtu, link.Attrs().Name)
+		log.Debug("MTU already set", logger.KeyIfname, link.Attrs().Name, "mtu", mtu)
 		return nil
 	}
 
-	logger.Debugf("[netdev] setting MTU %d for %s (old=%d)", mtu, link.Attrs().Name, current)
-	if err := netlink.LinkSetMTU(link, mtu); err != nil {
-		logger.Errorf("[netdev] failed to set MTU on %s: %v", link.Attrs().Name, err)
-		return fmt.Errorf("set MTU on %s: %w", link.Attrs().Name, err)
+	log.Debug("setting MTU", logger.KeyIfname, link.Attrs().Name, "mtu", mtu, "old_mtu", current)
+	details := map[string]int{"old_mtu": current, "mtu": mtu}
+	if err := audit.Do(ctx, audit.SetMTU, link.Attrs().Name, details, func() error { return m.handle.LinkSetMTU(link, mtu) }); err != nil {
+		log.Error("failed to set MTU", logger.KeyIfname, link.Attrs().Name, logger.KeyErr, err)
+		return linkError("set MTU on", link.Attrs().Name, err)
 	}
 	return nil
 }
 
-func CreateTap(baseName string, mtu int, withVnetHdr bool) (string, error) {
+func (m *Manager) CreateTap(ctx context.Context, baseName string, mtu int, withVnetHdr bool) (string, error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "netdev.create_tap", tracing.IfName.String(sanitizeIfaceName(baseName)))
+	ifName, err := m.createTap(ctx, baseName, mtu, withVnetHdr)
+	metrics.ObserveOp(metrics.OpCreateTap, start, err)
+	tracing.End(span, err)
+	return ifName, err
+}
+
+func (m *Manager) createTap(ctx context.Context, baseName string, mtu int, withVnetHdr bool) (string, error) {
 	ifName := sanitizeIfaceName(baseName)
-	logger.Debugf("[netdev] creating TAP %s (mtu=%d, vnetHdr=%t)", ifName, mtu, withVnetHdr)
+	log.Debug("creating TAP", logger.KeyIfname, ifName, "mtu", mtu, "vnet_hdr", withVnetHdr)
 
-	if link, exists, err := getLink(ifName); err != nil {
-		logger.Errorf("[netdev] failed to check existing link %s: %v", ifName, err)
+	if link, exists, err := m.getLink(ifName); err != nil {
+		log.Error("failed to check existing link", logger.KeyIfname, ifName, logger.KeyErr, err)
 		return ifName, err
 	} else if exists {
 		if _, ok := link.(*netlink.Tuntap); !ok {
-			logger.Errorf("[netdev] %s exists but is not a TAP (type=%T)", ifName, link)
-			return ifName, fmt.Errorf("link %q exists but is not a TAP", ifName)
+			log.Error("link exists but is not a TAP", logger.KeyIfname, ifName, "type", link.Type())
+			return ifName, &LinkError{Op: "create TAP", Name: ifName, Kind: ErrWrongType}
 		}
-		if err := ensureMTU(link, mtu); err != nil {
+		if err := m.ensureMTU(ctx, link, mtu); err != nil {
 			return ifName, err
 		}
-		logger.Infof("[netdev] TAP %s already exists", ifName)
+		log.Info("TAP already exists", logger.KeyIfname, ifName)
 		return ifName, nil
 	}
 
-	flags := netlink.TUNTAP_NO_PI
+	flags := uint16(unix.IFF_TAP | unix.IFF_NO_PI)
 	if withVnetHdr {
-		flags |= netlink.TUNTAP_VNET_HDR
+		flags |= unix.IFF_VNET_HDR
 	}
 
-	tap := &netlink.Tuntap{
-		LinkAttrs: netlink.LinkAttrs{
-			Name: ifName,
-			MTU:  mtu,
-		},
-		Mode:  netlink.TUNTAP_MODE_TAP,
-		Flags: flags,
+	details := map[string]any{"kind": KindTap, "mtu": mtu, "vnet_hdr": withVnetHdr}
+	err := audit.Do(ctx, audit.CreateLink, ifName, details, func() error {
+		return m.inNetns(func() error { return addPersistentTap(ifName, flags) })
+	})
+	if err != nil {
+		log.Error("failed to add TAP", logger.KeyIfname, ifName, logger.KeyErr, err)
+		return ifName, linkError("add TAP", ifName, err)
 	}
 
-	if err := netlink.LinkAdd(tap); err != nil {
-		logger.Errorf("[netdev] failed to add TAP %s: %v", ifName, err)
-		return ifName, fmt.Errorf("add TAP %s: %w", ifName, err)
+	// TUNSETIFF has no MTU; set it like on an existing TAP.
+	link, err := m.handle.LinkByName(ifName)
+	if err != nil {
+		log.Error("failed to look up new TAP", logger.KeyIfname, ifName, logger.KeyErr, err)
+		return ifName, linkError("lookup link", ifName, err)
+	}
+	if err := m.ensureMTU(ctx, link, mtu); err != nil {
+		return ifName, err
 	}
 
-	logger.Infof("[netdev] created TAP %s", ifName)
+	log.Info("created TAP", logger.KeyIfname, ifName)
 	return ifName, nil
 }
 
-func DeleteLink(baseName string) error {
+// addPersistentTap creates a persistent TAP in the calling thread's netns.
+// netlink's Tuntap support formats ioctl failures as text; doing the ioctls
+// here keeps the errno for classify.
+func addPersistentTap(ifName string, flags uint16) error {
+	const tunDev = "/dev/net/tun"
+	fd, err := unix.Open(tunDev, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: tunDev, Err: err}
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq(ifName)
+	if err != nil {
+		return err
+	}
+	ifr.SetUint16(flags)
+	if err := unix.IoctlIfreq(fd, unix.TUNSETIFF, ifr); err != nil {
+		return os.NewSyscallError("TUNSETIFF", err)
+	}
+	if err := unix.IoctlSetInt(fd, unix.TUNSETPERSIST, 1); err != nil {
+		return os.NewSyscallError("TUNSETPERSIST", err)
+	}
+	return nil
+}
+
+func (m *Manager) DeleteLink(ctx context.Context, baseName string) (err error) {
 	ifName := sanitizeIfaceName(baseName)
-	logger.Infof("[netdev] deleting link %s", ifName)
+	ctx, span := tracing.Start(ctx, "netdev.delete_link", tracing.IfName.String(ifName))
+	defer func() { tracing.End(span, err) }()
+	log.Info("deleting link", logger.KeyIfname, ifName)
 
-	link, exists, err := getLink(ifName)
+	link, exists, err := m.getLink(ifName)
 	if err != nil {
-		logger.Errorf("[netdev] failed to check link %s: %v", ifName, err)
+		log.Error("failed to check link", logger.KeyIfname, ifName, logger.KeyErr, err)
 		return err
 	}
 
 	if !exists {
-		logger.Warnf("[netdev] link %s not found, nothing to delete", ifName)
+		log.Warn("link not found, nothing to delete", logger.KeyIfname, ifName)
 		return nil
 	}
 
-	if err := netlink.LinkDel(link); err != nil {
-		logger.Errorf("[netdev] failed to delete link %s: %v", ifName, err)
-		return fmt.Errorf("delete link %s: %w", ifName, err)
+	if err := audit.Do(ctx, audit.DeleteLink, ifName, map[string]string{"type": link.Type()}, func() error { return m.handle.LinkDel(link) }); err != nil {
+		log.Error("failed to delete link", logger.KeyIfname, ifName, logger.KeyErr, err)
+		return linkError("delete link", ifName, err)
 	}
 
-	logger.Infof("[netdev] deleted link %s", ifName)
+	log.Info("deleted link", logger.KeyIfname, ifName)
 	return nil
 
 }
 
-func SetLinkUp(baseName string) (string, error) {
-	ifName := sanitizeIfaceName(baseName)
-	logger.Infof("[netdev] setting link %s UP", ifName)
+func (m *Manager) SetLinkUp(ctx context.Context, baseName string) (ifName string, err error) {
+	ifName = sanitizeIfaceName(baseName)
+	ctx, span := tracing.Start(ctx, "netdev.set_link_up", tracing.IfName.String(ifName))
+	defer func() { tracing.End(span, err) }()
+	log.Info("setting link up", logger.KeyIfname, ifName)
 
-	link, exists, err := getLink(ifName)
+	link, exists, err := m.getLink(ifName)
 	if err != nil {
 		return ifName, err
 	}
 
 	if !exists {
-		logger.Errorf("[netdev] link %s not found, nothing to set UP", ifName)
-		return ifName, fmt.Errorf("link %s does not exists, try maybe creating it first", ifName)
+		log.Error("link not found, nothing to set up", logger.KeyIfname, ifName)
+		return ifName, &LinkError{Op: "link up", Name: ifName, Kind: ErrNotFound}
 	} else {
-		if _, ok := link.(*netlink.Tuntap); !ok {
-			logger.Errorf("[netdev] %s exists but is not a TAP", ifName)
-			return ifName, fmt.Errorf("link %q exists but is not a TAP", ifName)
+		if !isVifLink(link) {
+			log.Error("link exists but is not a VIF device", logger.KeyIfname, ifName, "type", link.Type())
+			return ifName, &LinkError{Op: "link up", Name: ifName, Kind: ErrWrongType}
 		}
 	}
 
-	if err := netlink.LinkSetUp(link); err != nil {
-		logger.Errorf("[netdev] failed to bring %s UP: %v", ifName, err)
-		return ifName, fmt.Errorf("link up %s: %w", ifName, err)
+	if err := audit.Do(ctx, audit.LinkUp, ifName, nil, func() error { return m.handle.LinkSetUp(link) }); err != nil {
+		log.Error("failed to bring link up", logger.KeyIfname, ifName, logger.KeyErr, err)
+		return ifName, linkError("link up", ifName, err)
 	}
 
-	logger.Infof("[netdev] link %s is UP", ifName)
+	log.Info("link is up", logger.KeyIfname, ifName)
 	return ifName, nil
 }
 
-func SetLinkDown(baseName string) error {
+func (m *Manager) SetLinkDown(ctx context.Context, baseName string) (err error) {
 	ifName := sanitizeIfaceName(baseName)
-	logger.Infof("[netdev] setting link %s DOWN", ifName)
+	ctx, span := tracing.Start(ctx, "netdev.set_link_down", tracing.IfName.String(ifName))
+	defer func() { tracing.End(span, err) }()
+	log.Info("setting link down", logger.KeyIfname, ifName)
 
-	link, exists, err := getLink(ifName)
+	link, exists, err := m.getLink(ifName)
 	if err != nil {
 		return err
 	}
 	if !exists {
-		logger.Errorf("[netdev] link %s not found, nothing to set down", ifName)
-		return fmt.Errorf("link %s does not exists, try maybe creating it first", ifName)
+		log.Error("link not found, nothing to set down", logger.KeyIfname, ifName)
+		return &LinkError{Op: "link down", Name: ifName, Kind: ErrNotFound}
 	}
-	if err := netlink.LinkSetDown(link); err != nil {
-		logger.Errorf("[netdev] failed to bring %s DOWN: %v", ifName, err)
-		return fmt.Errorf("link down %s: %w", ifName, err)
+	if err := audit.Do(ctx, audit.LinkDown, ifName, nil, func() error { return m.handle.LinkSetDown(link) }); err != nil {
+		log.Error("failed to bring link down", logger.KeyIfname, ifName, logger.KeyErr, err)
+		return linkError("link down", ifName, err)
 	}
 
-	logger.Infof("[netdev] link %s is DOWN", ifName)
+	log.Info("link is down", logger.KeyIfname, ifName)
 	return nil
 }
+
+// LinkInfo is a device's state as the kernel reports it.
+type LinkInfo struct {
+	Name      string
+	Type      string
+	MAC       string
+	MTU       int
+	AdminUp   bool
+	OperState string // e.g. "up", "down", "lowerlayerdown"
+}
+
+// LinkInfo looks up baseName's device. A missing device is an ErrNotFound
+// LinkError.
+func (m *Manager) LinkInfo(baseName string) (LinkInfo, error) {
+	ifName := sanitizeIfaceName(baseName)
+	link, exists, err := m.getLink(ifName)
+	if err != nil {
+		return LinkInfo{Name: ifName}, err
+	}
+	if !exists {
+		return LinkInfo{Name: ifName}, &LinkError{Op: "lookup link", Name: ifName, Kind: ErrNotFound}
+	}
+	attrs := link.Attrs()
+	return LinkInfo{
+		Name:      ifName,
+		Type:      link.Type(),
+		MAC:       attrs.HardwareAddr.String(),
+		MTU:       attrs.MTU,
+		AdminUp:   attrs.Flags&net.FlagUp != 0,
+		OperState: attrs.OperState.String(),
+	}, nil
+}
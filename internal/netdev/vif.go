@@ -0,0 +1,274 @@
+package netdev
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"github.com/yangjie500/cloud-ovs-agent/internal/audit"
+	"github.com/yangjie500/cloud-ovs-agent/internal/tracing"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+	"golang.org/x/sys/unix"
+)
+
+// Kind is the device type backing a VIF.
+type Kind string
+
+const (
+	KindTap     Kind = "tap"
+	KindMacvtap Kind = "macvtap"
+	KindIpvlan  Kind = "ipvlan"
+)
+
+func ParseKind(s string) (Kind, error) {
+	switch k := Kind(strings.ToLower(s)); k {
+	case "":
+		return KindTap, nil
+	case KindTap, KindMacvtap, KindIpvlan:
+		return k, nil
+	default:
+		return "", fmt.Errorf("unknown VIF kind %q", s)
+	}
+}
+
+// AttachesToOVS reports whether ports of this kind are plugged into an OVS bridge.
+// macvtap and ipvlan sit directly on an uplink and bypass OVS.
+func (k Kind) AttachesToOVS() bool {
+	return k == KindTap || k == ""
+}
+
+// VifSpec describes the device to create for a port.
+type VifSpec struct {
+	Kind    Kind
+	MTU     int
+	VnetHdr bool   // tap only
+	Parent  string // uplink for macvtap/ipvlan
+	Mode    string // macvtap: bridge|passthru|vepa|private, ipvlan: l2|l3|l3s
+	Profile *Profile
+}
+
+// Vif is a created device. DevicePath is the character device the VMM opens,
+// set for macvtap only.
+type Vif struct {
+	Name       string
+	Kind       Kind
+	DevicePath string
+}
+
+// CreateVif creates (or adopts) the device described by spec and applies its profile.
+func (m *Manager) CreateVif(ctx context.Context, baseName string, spec VifSpec) (_ Vif, err error) {
+	ctx, span := tracing.Start(ctx, "netdev.create_vif",
+		tracing.IfName.String(sanitizeIfaceName(baseName)), tracing.VifKind.String(string(spec.Kind)))
+	defer func() { tracing.End(span, err) }()
+
+	vif, err := m.createVif(ctx, baseName, spec)
+	if err != nil {
+		return vif, err
+	}
+	if _, err := m.ApplyProfile(ctx, baseName, spec.Profile); err != nil {
+		log.Error("failed to apply profile", logger.KeyIfname, vif.Name, logger.KeyErr, err)
+		return vif, err
+	}
+	return vif, nil
+}
+
+func (m *Manager) createVif(ctx context.Context, baseName string, spec VifSpec) (Vif, error) {
+	switch spec.Kind {
+	case KindTap, "":
+		ifName, err := m.CreateTap(ctx, baseName, spec.MTU, spec.VnetHdr)
+		return Vif{Name: ifName, Kind: KindTap}, err
+	case KindMacvtap:
+		ifName, devPath, err := m.CreateMacvtap(ctx, baseName, spec.Parent, spec.Mode, spec.MTU)
+		return Vif{Name: ifName, Kind: KindMacvtap, DevicePath: devPath}, err
+	case KindIpvlan:
+		ifName, err := m.CreateIpvlan(ctx, baseName, spec.Parent, spec.Mode, spec.MTU)
+		return Vif{Name: ifName, Kind: KindIpvlan}, err
+	default:
+		return Vif{}, fmt.Errorf("unknown VIF kind %q", spec.Kind)
+	}
+}
+
+func macvtapMode(mode string) (netlink.MacvlanMode, error) {
+	switch mode {
+	case "", "bridge":
+		return netlink.MACVLAN_MODE_BRIDGE, nil
+	case "passthru":
+		return netlink.MACVLAN_MODE_PASSTHRU, nil
+	case "vepa":
+		return netlink.MACVLAN_MODE_VEPA, nil
+	case "private":
+		return netlink.MACVLAN_MODE_PRIVATE, nil
+	}
+	return 0, fmt.Errorf("unknown macvtap mode %q", mode)
+}
+
+func ipvlanMode(mode string) (netlink.IPVlanMode, error) {
+	switch mode {
+	case "", "l2":
+		return netlink.IPVLAN_MODE_L2, nil
+	case "l3":
+		return netlink.IPVLAN_MODE_L3, nil
+	case "l3s":
+		return netlink.IPVLAN_MODE_L3S, nil
+	}
+	return 0, fmt.Errorf("unknown ipvlan mode %q", mode)
+}
+
+func (m *Manager) parentIndex(op, parent string) (int, error) {
+	if parent == "" {
+		return 0, fmt.Errorf("%s: no parent device given", op)
+	}
+	link, exists, err := m.getLink(parent)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, &LinkError{Op: op + " parent", Name: parent, Kind: ErrNotFound}
+	}
+	return link.Attrs().Index, nil
+}
+
+func (m *Manager) CreateMacvtap(ctx context.Context, baseName, parent, mode string, mtu int) (string, string, error) {
+	ifName := sanitizeIfaceName(baseName)
+	log.Debug("creating macvtap", logger.KeyIfname, ifName, "parent", parent, "mode", mode, "mtu", mtu)
+
+	mvMode, err := macvtapMode(mode)
+	if err != nil {
+		return ifName, "", err
+	}
+	if m.ns.IsOpen() {
+		// The character device is found through sysfs and created in /dev,
+		// both of which belong to the agent's namespace, not the VIF's.
+		return ifName, "", &LinkError{Op: "create macvtap", Name: ifName, Kind: ErrUnsupported,
+			Err: errors.New("macvtap is not supported with netdev.netns set")}
+	}
+
+	link, exists, err := m.getLink(ifName)
+	if err != nil {
+		return ifName, "", err
+	}
+	if exists {
+		if _, ok := link.(*netlink.Macvtap); !ok {
+			log.Error("link exists but is not a macvtap", logger.KeyIfname, ifName, "type", link.Type())
+			return ifName, "", &LinkError{Op: "create macvtap", Name: ifName, Kind: ErrWrongType}
+		}
+		if err := m.ensureMTU(ctx, link, mtu); err != nil {
+			return ifName, "", err
+		}
+		log.Info("macvtap already exists", logger.KeyIfname, ifName)
+	} else {
+		parentIdx, err := m.parentIndex("create macvtap", parent)
+		if err != nil {
+			return ifName, "", err
+		}
+		mv := &netlink.Macvtap{
+			Macvlan: netlink.Macvlan{
+				LinkAttrs: netlink.LinkAttrs{Name: ifName, MTU: mtu, ParentIndex: parentIdx},
+				Mode:      mvMode,
+			},
+		}
+		details := map[string]any{"kind": KindMacvtap, "parent": parent, "mode": mode, "mtu": mtu}
+		if err := audit.Do(ctx, audit.CreateLink, ifName, details, func() error { return m.handle.LinkAdd(mv) }); err != nil {
+			log.Error("failed to add macvtap", logger.KeyIfname, ifName, logger.KeyErr, err)
+			return ifName, "", linkError("add macvtap", ifName, err)
+		}
+		if link, err = m.handle.LinkByName(ifName); err != nil {
+			return ifName, "", linkError("lookup link", ifName, err)
+		}
+		log.Info("created macvtap", logger.KeyIfname, ifName, "parent", parent)
+	}
+
+	devPath, err := m.ensureTapCharDev(ifName, link.Attrs().Index)
+	if err != nil {
+		return ifName, "", err
+	}
+	return ifName, devPath, nil
+}
+
+// ensureTapCharDev makes sure /dev/tapN exists for a macvtap. udev normally
+// creates it; on hosts without udev rules for macvtap it is created from sysfs.
+func (m *Manager) ensureTapCharDev(ifName string, index int) (string, error) {
+	devPath := fmt.Sprintf("/dev/tap%d", index)
+	if _, err := os.Stat(devPath); err == nil {
+		log.Debug("tap device present", logger.KeyIfname, ifName, "dev", devPath)
+		return devPath, nil
+	}
+
+	sysPath := filepath.Join("/sys/class/net", ifName, "macvtap", fmt.Sprintf("tap%d", index), "dev")
+	raw, err := os.ReadFile(sysPath)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", sysPath, err)
+	}
+	majStr, minStr, ok := strings.Cut(strings.TrimSpace(string(raw)), ":")
+	if !ok {
+		return "", fmt.Errorf("unexpected device number %q in %s", raw, sysPath)
+	}
+	major, err := strconv.ParseUint(majStr, 10, 32)
+	if err != nil {
+		return "", fmt.Errorf("parse major in %s: %w", sysPath, err)
+	}
+	minor, err := strconv.ParseUint(minStr, 10, 32)
+	if err != nil {
+		return "", fmt.Errorf("parse minor in %s: %w", sysPath, err)
+	}
+
+	if err := unix.Mknod(devPath, unix.S_IFCHR|0600, int(unix.Mkdev(uint32(major), uint32(minor)))); err != nil {
+		return "", fmt.Errorf("mknod %s: %w", devPath, err)
+	}
+	log.Info("created tap device", logger.KeyIfname, ifName, "dev", devPath, "devno", fmt.Sprintf("%d:%d", major, minor))
+	return devPath, nil
+}
+
+func (m *Manager) CreateIpvlan(ctx context.Context, baseName, parent, mode string, mtu int) (string, error) {
+	ifName := sanitizeIfaceName(baseName)
+	log.Debug("creating ipvlan", logger.KeyIfname, ifName, "parent", parent, "mode", mode, "mtu", mtu)
+
+	ipMode, err := ipvlanMode(mode)
+	if err != nil {
+		return ifName, err
+	}
+
+	if link, exists, err := m.getLink(ifName); err != nil {
+		return ifName, err
+	} else if exists {
+		if _, ok := link.(*netlink.IPVlan); !ok {
+			log.Error("link exists but is not an ipvlan", logger.KeyIfname, ifName, "type", link.Type())
+			return ifName, &LinkError{Op: "create ipvlan", Name: ifName, Kind: ErrWrongType}
+		}
+		if err := m.ensureMTU(ctx, link, mtu); err != nil {
+			return ifName, err
+		}
+		log.Info("ipvlan already exists", logger.KeyIfname, ifName)
+		return ifName, nil
+	}
+
+	parentIdx, err := m.parentIndex("create ipvlan", parent)
+	if err != nil {
+		return ifName, err
+	}
+	ipv := &netlink.IPVlan{
+		LinkAttrs: netlink.LinkAttrs{Name: ifName, MTU: mtu, ParentIndex: parentIdx},
+		Mode:      ipMode,
+	}
+	details := map[string]any{"kind": KindIpvlan, "parent": parent, "mode": mode, "mtu": mtu}
+	if err := audit.Do(ctx, audit.CreateLink, ifName, details, func() error { return m.handle.LinkAdd(ipv) }); err != nil {
+		log.Error("failed to add ipvlan", logger.KeyIfname, ifName, logger.KeyErr, err)
+		return ifName, linkError("add ipvlan", ifName, err)
+	}
+
+	log.Info("created ipvlan", logger.KeyIfname, ifName, "parent", parent)
+	return ifName, nil
+}
+
+func isVifLink(link netlink.Link) bool {
+	switch link.(type) {
+	case *netlink.Tuntap, *netlink.Macvtap, *netlink.IPVlan:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,419 @@
+package netdev
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/yangjie500/cloud-ovs-agent/internal/audit"
+	"github.com/yangjie500/cloud-ovs-agent/internal/metrics"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+	"golang.org/x/sys/unix"
+)
+
+type LinkEventKind string
+
+const (
+	LinkDeleted        LinkEventKind = "deleted"
+	LinkRenamed        LinkEventKind = "renamed"
+	LinkMTUChanged     LinkEventKind = "mtu-changed"
+	LinkAdminDown      LinkEventKind = "admin-down"
+	LinkCarrierChanged LinkEventKind = "carrier-changed"
+	LinkProfileDrift   LinkEventKind = "profile-drift"
+)
+
+// LinkEvent describes drift of a managed device away from the state the agent left it in.
+type LinkEvent struct {
+	Kind     LinkEventKind
+	Name     string // name the agent manages the device under
+	NewName  string // set for LinkRenamed
+	OldMTU   int
+	NewMTU   int
+	Carrier  bool   // set for LinkCarrierChanged
+	Detail   string // set for LinkProfileDrift
+	Repaired bool
+	Err      error // repair error, if a repair was attempted and failed
+}
+
+// String describes the change, e.g. "renamed to vm1-old" or "mtu-changed to
+// 9000 (want 1500)".
+func (e LinkEvent) String() string {
+	switch e.Kind {
+	case LinkRenamed:
+		return fmt.Sprintf("%s to %s", e.Kind, e.NewName)
+	case LinkMTUChanged:
+		return fmt.Sprintf("%s to %d (want %d)", e.Kind, e.NewMTU, e.OldMTU)
+	case LinkCarrierChanged:
+		if e.Carrier {
+			return string(e.Kind) + " to up"
+		}
+		return string(e.Kind) + " to down"
+	case LinkProfileDrift:
+		return string(e.Kind) + ": " + e.Detail
+	}
+	return string(e.Kind)
+}
+
+type managedLink struct {
+	name     string
+	index    int
+	mtu      int
+	spec     VifSpec
+	resolved bool
+
+	// last observed state, so drift is reported once per transition
+	seenName string
+	seenMTU  int
+	seenUp   bool
+	carrier  bool
+}
+
+// LinkWatcher follows netlink link updates for the devices the agent created and
+// either repairs or reports any drift, depending on SetRepair. Device profiles
+// are always re-applied, on link updates and every reconcile interval.
+type LinkWatcher struct {
+	Netdev  *Manager
+	OnEvent func(LinkEvent)
+
+	mu        sync.Mutex
+	links     map[string]*managedLink
+	byIndex   map[int]string
+	repairs   bool
+	interval  time.Duration
+	intervalC chan struct{}
+}
+
+func NewLinkWatcher(mgr *Manager, repair bool, onEvent func(LinkEvent)) *LinkWatcher {
+	return &LinkWatcher{
+		Netdev:    mgr,
+		OnEvent:   onEvent,
+		links:     make(map[string]*managedLink),
+		byIndex:   make(map[int]string),
+		repairs:   repair,
+		intervalC: make(chan struct{}, 1),
+	}
+}
+
+func (w *LinkWatcher) SetRepair(repair bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.repairs = repair
+}
+
+func (w *LinkWatcher) repairEnabled() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.repairs
+}
+
+// SetReconcileInterval changes how often profiles are re-applied; zero disables
+// the periodic pass. Safe to call while Run is active.
+func (w *LinkWatcher) SetReconcileInterval(d time.Duration) {
+	w.mu.Lock()
+	w.interval = d
+	w.mu.Unlock()
+
+	select {
+	case w.intervalC <- struct{}{}:
+	default:
+	}
+}
+
+func (w *LinkWatcher) reconcileInterval() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.interval
+}
+
+// Manage starts tracking a device the agent has just created and brought up.
+func (w *LinkWatcher) Manage(baseName string, spec VifSpec) {
+	ifName := sanitizeIfaceName(baseName)
+	mtu := spec.MTU
+	m := &managedLink{name: ifName, mtu: mtu, spec: spec, seenName: ifName, seenUp: true}
+
+	link, exists, err := w.Netdev.getLink(ifName)
+	if err != nil {
+		log.Warn("cannot resolve link for watching", logger.KeyIfname, ifName, logger.KeyErr, err)
+	} else if exists {
+		m.index = link.Attrs().Index
+		m.carrier = link.Attrs().OperState == netlink.OperUp
+		m.resolved = true
+		// Start from the device's MTU, not the requested one: only a change
+		// made after this point is drift.
+		m.seenMTU = link.Attrs().MTU
+		if mtu <= 0 {
+			m.mtu = m.seenMTU
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if old, ok := w.links[ifName]; ok && old.resolved {
+		delete(w.byIndex, old.index)
+	}
+	w.links[ifName] = m
+	if m.resolved {
+		w.byIndex[m.index] = ifName
+	}
+	metrics.SetManagedPorts(len(w.links))
+	log.Debug("watching link", logger.KeyIfname, ifName, "index", m.index, "mtu", m.mtu)
+}
+
+// Unmanage stops tracking a device; call it before the agent removes the device itself.
+func (w *LinkWatcher) Unmanage(baseName string) {
+	ifName := sanitizeIfaceName(baseName)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if m, ok := w.links[ifName]; ok {
+		if m.resolved {
+			delete(w.byIndex, m.index)
+		}
+		delete(w.links, ifName)
+		metrics.SetManagedPorts(len(w.links))
+		log.Debug("stopped watching link", logger.KeyIfname, ifName)
+	}
+}
+
+// Run subscribes to link updates until ctx is done, resubscribing if the netlink socket fails.
+func (w *LinkWatcher) Run(ctx context.Context) {
+	go w.reconcileLoop(ctx)
+
+	for {
+		if err := w.subscribe(ctx); err != nil {
+			log.Error("link subscription failed", logger.KeyErr, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+			log.Info("resubscribing to link updates")
+		}
+	}
+}
+
+func (w *LinkWatcher) subscribe(ctx context.Context) error {
+	ch := make(chan netlink.LinkUpdate, 64)
+	done := make(chan struct{})
+	defer close(done)
+
+	ns := w.Netdev.ns
+	err := netlink.LinkSubscribeWithOptions(ch, done, netlink.LinkSubscribeOptions{
+		Namespace:    &ns,
+		ListExisting: true,
+		ErrorCallback: func(err error) {
+			log.Warn("link subscription error", logger.KeyErr, err)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("subscribe link updates: %w", err)
+	}
+	log.Info("subscribed to link updates")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case u, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("link update channel closed")
+			}
+			w.handleUpdate(ctx, u)
+		}
+	}
+}
+
+func (w *LinkWatcher) handleUpdate(ctx context.Context, u netlink.LinkUpdate) {
+	attrs := u.Link.Attrs()
+	var events []LinkEvent
+
+	w.mu.Lock()
+	name, ok := w.byIndex[attrs.Index]
+	if !ok {
+		// A device recreated under a managed name gets a new index.
+		if m, found := w.links[attrs.Name]; found && u.Header.Type == unix.RTM_NEWLINK {
+			if m.resolved {
+				delete(w.byIndex, m.index)
+			}
+			m.index = attrs.Index
+			m.resolved = true
+			w.byIndex[attrs.Index] = m.name
+			name, ok = m.name, true
+		}
+	}
+	if !ok {
+		w.mu.Unlock()
+		return
+	}
+	m := w.links[name]
+
+	if u.Header.Type == unix.RTM_DELLINK {
+		delete(w.byIndex, m.index)
+		m.resolved = false
+		// Nothing is known about a device that comes back under this name.
+		m.seenName, m.seenMTU, m.seenUp = m.name, 0, true
+		events = append(events, LinkEvent{Kind: LinkDeleted, Name: m.name})
+	} else {
+		if attrs.Name != m.seenName {
+			m.seenName = attrs.Name
+			if attrs.Name != m.name {
+				events = append(events, LinkEvent{Kind: LinkRenamed, Name: m.name, NewName: attrs.Name})
+			}
+		}
+		if attrs.MTU != m.seenMTU {
+			m.seenMTU = attrs.MTU
+			if m.mtu > 0 && attrs.MTU != m.mtu {
+				events = append(events, LinkEvent{Kind: LinkMTUChanged, Name: m.name, OldMTU: m.mtu, NewMTU: attrs.MTU})
+			}
+		}
+		if up := attrs.Flags&net.FlagUp != 0; up != m.seenUp {
+			m.seenUp = up
+			if !up {
+				events = append(events, LinkEvent{Kind: LinkAdminDown, Name: m.name})
+			}
+		}
+		if carrier := attrs.OperState == netlink.OperUp; carrier != m.carrier {
+			m.carrier = carrier
+			events = append(events, LinkEvent{Kind: LinkCarrierChanged, Name: m.name, Carrier: carrier})
+		}
+		if p := m.spec.Profile; p != nil {
+			if p.TxQueueLen > 0 && attrs.TxQLen != p.TxQueueLen {
+				events = append(events, LinkEvent{Kind: LinkProfileDrift, Name: m.name, Detail: fmt.Sprintf("txqueuelen=%d", attrs.TxQLen)})
+			} else if alias := p.aliasFor(m.name); alias != "" && attrs.Alias != alias {
+				events = append(events, LinkEvent{Kind: LinkProfileDrift, Name: m.name, Detail: fmt.Sprintf("alias=%q", attrs.Alias)})
+			}
+		}
+	}
+	want := *m
+	w.mu.Unlock()
+
+	for _, ev := range events {
+		if ev.Kind == LinkProfileDrift || w.repairEnabled() {
+			ev.Repaired, ev.Err = w.repair(ctx, ev, &want, u.Link)
+		}
+		w.report(ev)
+	}
+}
+
+func (w *LinkWatcher) reconcileLoop(ctx context.Context) {
+	for {
+		var tick <-chan time.Time
+		var t *time.Timer
+		if d := w.reconcileInterval(); d > 0 {
+			t = time.NewTimer(d)
+			tick = t.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-w.intervalC:
+			// interval changed; re-arm with the new value
+		case <-tick:
+			w.reconcileProfiles(ctx)
+		}
+		if t != nil {
+			t.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// reconcileProfiles re-applies profiles to catch drift netlink does not
+// announce, such as offload toggles.
+func (w *LinkWatcher) reconcileProfiles(ctx context.Context) {
+	ctx = audit.WithTrigger(ctx, audit.Trigger{Event: "reconcile"})
+
+	w.mu.Lock()
+	var want []managedLink
+	for _, m := range w.links {
+		if m.resolved && m.spec.Profile != nil {
+			want = append(want, *m)
+		}
+	}
+	w.mu.Unlock()
+
+	for i := range want {
+		changed, err := w.Netdev.ApplyProfile(ctx, want[i].name, want[i].spec.Profile)
+		if err == nil && len(changed) == 0 {
+			continue
+		}
+		w.report(LinkEvent{Kind: LinkProfileDrift, Name: want[i].name, Detail: strings.Join(changed, ", "), Repaired: err == nil, Err: err})
+	}
+}
+
+func (w *LinkWatcher) repair(ctx context.Context, ev LinkEvent, want *managedLink, link netlink.Link) (bool, error) {
+	if !w.isManaged(want.name) {
+		return false, nil
+	}
+	ctx = audit.WithTrigger(ctx, audit.Trigger{Event: "repair", Reason: string(ev.Kind)})
+	h := w.Netdev.handle
+
+	switch ev.Kind {
+	case LinkDeleted:
+		if _, err := w.Netdev.CreateVif(ctx, want.name, want.spec); err != nil {
+			return false, err
+		}
+		if _, err := w.Netdev.SetLinkUp(ctx, want.name); err != nil {
+			return false, err
+		}
+	case LinkRenamed:
+		if err := audit.Do(ctx, audit.LinkDown, ev.NewName, nil, func() error { return h.LinkSetDown(link) }); err != nil {
+			return false, linkError("link down", ev.NewName, err)
+		}
+		if err := audit.Do(ctx, audit.RenameLink, ev.NewName, map[string]string{"new_name": want.name}, func() error { return h.LinkSetName(link, want.name) }); err != nil {
+			return false, linkError("rename to "+want.name, ev.NewName, err)
+		}
+		if err := audit.Do(ctx, audit.LinkUp, want.name, nil, func() error { return h.LinkSetUp(link) }); err != nil {
+			return false, linkError("link up", want.name, err)
+		}
+	case LinkMTUChanged:
+		details := map[string]int{"old_mtu": ev.NewMTU, "mtu": want.mtu}
+		if err := audit.Do(ctx, audit.SetMTU, link.Attrs().Name, details, func() error { return h.LinkSetMTU(link, want.mtu) }); err != nil {
+			return false, linkError("set MTU on", link.Attrs().Name, err)
+		}
+	case LinkAdminDown:
+		if err := audit.Do(ctx, audit.LinkUp, link.Attrs().Name, nil, func() error { return h.LinkSetUp(link) }); err != nil {
+			return false, linkError("link up", link.Attrs().Name, err)
+		}
+	case LinkProfileDrift:
+		if _, err := w.Netdev.ApplyProfile(ctx, want.name, want.spec.Profile); err != nil {
+			return false, err
+		}
+	default:
+		// Carrier follows the VMM or the uplink; nothing to repair.
+		return false, nil
+	}
+	return true, nil
+}
+
+func (w *LinkWatcher) isManaged(ifName string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.links[ifName]
+	return ok
+}
+
+func (w *LinkWatcher) report(ev LinkEvent) {
+	log := log.With(logger.KeyIfname, ev.Name, "event", string(ev.Kind))
+	switch {
+	case ev.Err != nil:
+		log.Error("repair failed", logger.KeyErr, ev.Err)
+	case ev.Repaired:
+		log.Info("repaired", "detail", ev.Detail)
+	case ev.Kind == LinkCarrierChanged:
+		log.Info("carrier changed", "carrier", ev.Carrier)
+	default:
+		log.Warn("unexpected link change", "new_name", ev.NewName, "old_mtu", ev.OldMTU, "new_mtu", ev.NewMTU, "detail", ev.Detail)
+	}
+
+	if w.OnEvent != nil {
+		w.OnEvent(ev)
+	}
+}
@@ -0,0 +1,51 @@
+package netdev
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestLinkWatcherMTUDrift(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+
+	// A TAP whose MTU differs from the requested one, e.g. because it could
+	// not be applied.
+	if _, err := m.CreateTap(ctx, "vm_watch", 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.SetLinkUp(ctx, "vm_watch"); err != nil {
+		t.Fatal(err)
+	}
+	var events []LinkEvent
+	w := NewLinkWatcher(m, false, func(ev LinkEvent) { events = append(events, ev) })
+	w.Manage("vm_watch", VifSpec{Kind: KindTap, MTU: 9000})
+
+	update := func() {
+		t.Helper()
+		link, err := m.handle.LinkByName("vm-watch")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.handleUpdate(ctx, netlink.LinkUpdate{Link: link})
+	}
+
+	update()
+	if len(events) != 0 {
+		t.Fatalf("events = %v for an unchanged device, want none", events)
+	}
+
+	link, _ := m.handle.LinkByName("vm-watch")
+	if err := m.handle.LinkSetMTU(link, 1400); err != nil {
+		t.Fatal(err)
+	}
+	update()
+	if len(events) != 1 || events[0].Kind != LinkMTUChanged || events[0].NewMTU != 1400 {
+		t.Fatalf("events = %v, want one mtu-changed to 1400", events)
+	}
+	if events[0].Repaired {
+		t.Error("drift was repaired with repair disabled")
+	}
+}
@@ -21,7 +21,7 @@ func buildCreateInterfaceOps(client client.Client, ifaceUUID, ifName, logicalPor
 
 	ops, err := client.Create(ifRow)
 	if err != nil {
-		logger.Errorf("[ovs] build create-if op failed: %v", err)
+		log.Error("build create-if op failed", logger.KeyIfname, ifName, logger.KeyErr, err)
 		return nil, err
 	}
 	return ops, nil
@@ -35,7 +35,7 @@ func buildCreatePortOps(client client.Client, portUUID, portName, ifaceRef strin
 	}
 	ops, err := client.Create(portRow)
 	if err != nil {
-		logger.Errorf("[ovs] build create-port op failed %v", err)
+		log.Error("build create-port op failed", "port", portName, logger.KeyErr, err)
 		return nil, err
 	}
 	return ops, nil
@@ -57,7 +57,7 @@ func buildAttachPortToBridgeOps(client client.Client, bridgeUUID, portRef string
 
 func buildDetachPortFromBridgeOps(client client.Client, bridgeUUID, portRef string) ([]ovsdb.Operation, error) {
 	if bridgeUUID == "" || portRef == "" {
-		logger.Errorf("detach: empty bridge or port UUID; bridge=%s port=%s", bridgeUUID, portRef)
+		log.Error("detach: empty bridge or port UUID", "bridge_uuid", bridgeUUID, "port_uuid", portRef)
 		return nil, fmt.Errorf("detach: empty bridge or port UUID")
 	}
 	m := &Bridge{UUID: bridgeUUID}
@@ -68,7 +68,7 @@ func buildDetachPortFromBridgeOps(client client.Client, bridgeUUID, portRef stri
 	})
 
 	if err != nil {
-		logger.Errorf("build delete bridge mutate (detach port) failed: %v", err)
+		log.Error("build delete bridge mutate (detach port) failed", logger.KeyErr, err)
 		return nil, fmt.Errorf("build delete bridge mutate (detach port) failed: %w", err)
 	}
 
@@ -2,16 +2,45 @@ package ovs
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/ovn-kubernetes/libovsdb/client"
 	"github.com/ovn-kubernetes/libovsdb/model"
+	"github.com/yangjie500/cloud-ovs-agent/internal/monitor"
 	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
 )
 
+var log = logger.Named("ovs")
+
+// Common db.sock locations: distro packages, systems with /run only, and
+// source builds installed under /usr/local.
+var socketCandidates = []string{
+	"/var/run/openvswitch/db.sock",
+	"/run/openvswitch/db.sock",
+	"/usr/local/var/run/openvswitch/db.sock",
+}
+
+// DetectEndpoint returns a unix: endpoint for the first local OVSDB socket found.
+func DetectEndpoint() (string, error) {
+	for _, path := range socketCandidates {
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			log.Debug("detected OVSDB socket", "path", path)
+			return "unix:" + path, nil
+		}
+	}
+	return "", fmt.Errorf("no OVSDB socket found (tried %s)", strings.Join(socketCandidates, ", "))
+}
+
+// ConnectOVS connects to the local Open_vSwitch database and returns once
+// the initial monitor reply is in the client's cache.
 func ConnectOVS(ctx context.Context, endpoint string) (client.Client, error) {
 	start := time.Now()
-	logger.Infof("[ovs] connecting to OVSDB endpoint=%s", endpoint)
+	lr := log.Logr() // libovsdb adds its own endpoint fields
+	log := log.With("endpoint", endpoint)
+	log.Info("connecting to OVSDB")
 
 	dbModel, err := model.NewClientDBModel("Open_vSwitch", map[string]model.Model{
 		"Bridge":    &Bridge{},
@@ -20,30 +49,31 @@ func ConnectOVS(ctx context.Context, endpoint string) (client.Client, error) {
 	})
 
 	if err != nil {
-		logger.Errorf("[ovs] build ClientDBModel failed: %v", err)
+		log.Error("build ClientDBModel failed", logger.KeyErr, err)
 		return nil, err
 	}
-	logger.Debugf("[ovs] build ClientDBModel ready (tables: Bridge, Port, Interface)")
+	log.Debug("build ClientDBModel ready", "tables", "Bridge,Port,Interface")
 
-	ovs, err := client.NewOVSDBClient(dbModel, client.WithEndpoint(endpoint))
+	ovs, err := client.NewOVSDBClient(dbModel, client.WithEndpoint(endpoint), client.WithLogger(&lr))
 	if err != nil {
-		logger.Errorf("[ovs] NewOVSDBClient failed: %v", err)
+		log.Error("NewOVSDBClient failed", logger.KeyErr, err)
 		return nil, err
 	}
-	logger.Debugf("[ovs] client constructed")
+	log.Debug("client constructed")
 
 	if err := ovs.Connect(ctx); err != nil {
-		logger.Errorf("[ovs] Connect failed: %v", err)
+		log.Error("connect failed", logger.KeyErr, err)
 		return nil, err
 	}
-	logger.Infof("[ovs] TCP/UNIX session established (elasped=%s)", time.Since(start).Truncate(time.Millisecond))
+	log.Info("session established", "elapsed", time.Since(start).Truncate(time.Millisecond))
 
-	if _, err := ovs.MonitorAll(ctx); err != nil {
-		logger.Errorf("[ovs] MonitorAll failed: %v", err)
+	if err := monitor.Start(ctx, ovs, monitor.DefaultTimeout); err != nil {
+		log.Error("initial monitor sync failed", logger.KeyErr, err)
+		ovs.Close()
 		return nil, err
 	}
 
-	logger.Infof("[ovs] MonitorAll started")
+	log.Info("initial monitor sync done", "elapsed", time.Since(start).Truncate(time.Millisecond))
 
 	return ovs, nil
 }
@@ -3,6 +3,7 @@ package ovs
 import (
 	"context"
 	"fmt"
+	"slices"
 
 	"github.com/ovn-kubernetes/libovsdb/client"
 )
@@ -21,6 +22,12 @@ func findBridgeByName(ctx context.Context, client client.Client, name string) (*
 	return nil, fmt.Errorf("bridge %q not found", name)
 }
 
+// BridgeExists reports an error unless the named bridge is in the client's cache.
+func BridgeExists(ctx context.Context, client client.Client, name string) error {
+	_, err := findBridgeByName(ctx, client, name)
+	return err
+}
+
 func findPortByName(ctx context.Context, client client.Client, name string) (*Port, error) {
 	var ports []Port
 	if err := client.List(ctx, &ports); err != nil {
@@ -58,3 +65,53 @@ func bridgeHasPort(br *Bridge, portUUID string) bool {
 	}
 	return false
 }
+
+// Attachment is where an interface sits in the Open_vSwitch database.
+type Attachment struct {
+	Interface string // Interface UUID
+	Port      string // UUID of the Port holding the interface; empty if none
+	Bridge    string // name of the bridge holding Port; empty if none
+	IfaceID   string // external_ids:iface-id
+	OFPort    *int
+	Error     string // Interface error column, e.g. "could not open network device"
+}
+
+// LookupAttachment finds the interface named ifName and the port and bridge
+// it is on, reading only the client's cache. It returns nil if there is no
+// such interface.
+func LookupAttachment(ctx context.Context, client client.Client, ifName string) (*Attachment, error) {
+	iface, err := findInterfaceByName(ctx, client, ifName)
+	if err != nil || iface == nil {
+		return nil, err
+	}
+	a := &Attachment{Interface: iface.UUID, IfaceID: iface.ExternalIDs["iface-id"], OFPort: iface.OFPort}
+	if iface.Error != nil {
+		a.Error = *iface.Error
+	}
+
+	var ports []Port
+	if err := client.List(ctx, &ports); err != nil {
+		return nil, fmt.Errorf("list ports: %w", err)
+	}
+	for _, p := range ports {
+		if slices.Contains(p.Interfaces, iface.UUID) {
+			a.Port = p.UUID
+			break
+		}
+	}
+	if a.Port == "" {
+		return a, nil
+	}
+
+	var bridges []Bridge
+	if err := client.List(ctx, &bridges); err != nil {
+		return nil, fmt.Errorf("list bridges: %w", err)
+	}
+	for i := range bridges {
+		if bridgeHasPort(&bridges[i], a.Port) {
+			a.Bridge = bridges[i].Name
+			break
+		}
+	}
+	return a, nil
+}
@@ -11,6 +11,8 @@ type Interface struct {
 	Name        string            `ovsdb:"name"`
 	Type        string            `ovsdb:"type"`
 	ExternalIDs map[string]string `ovsdb:"external_ids"`
+	OFPort      *int              `ovsdb:"ofport"` // assigned by ovs-vswitchd; -1 if the interface failed
+	Error       *string           `ovsdb:"error"`
 }
 
 type Port struct {
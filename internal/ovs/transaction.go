@@ -3,37 +3,48 @@ package ovs
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/ovn-kubernetes/libovsdb/client"
 	"github.com/ovn-kubernetes/libovsdb/ovsdb"
+	"github.com/yangjie500/cloud-ovs-agent/internal/audit"
+	"github.com/yangjie500/cloud-ovs-agent/internal/metrics"
+	"github.com/yangjie500/cloud-ovs-agent/internal/tracing"
 	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
 )
 
-func EnsureInterfaceOnBridge(ctx context.Context, client client.Client, bridgeName, ifName, logicalPort string) error {
+func EnsureInterfaceOnBridge(ctx context.Context, client client.Client, bridgeName, ifName, logicalPort string) (err error) {
 	start := time.Now()
-	logger.Infof("[ovs] ensure interface on bridge: br=%s if=%s lp=%s", bridgeName, ifName, logicalPort)
+	ctx, span := tracing.Start(ctx, "ovs.ensure_interface",
+		tracing.LogicalPort.String(logicalPort), tracing.IfName.String(ifName), tracing.Bridge.String(bridgeName))
+	defer func() {
+		metrics.ObserveOp(metrics.OpEnsureInterface, start, err)
+		tracing.End(span, err)
+	}()
+	log := log.With(logger.KeyOp, "ensure-interface", logger.KeyLogicalPort, logicalPort, logger.KeyIfname, ifName, "bridge", bridgeName)
+	log.Info("ensure interface on bridge")
 
 	br, err := findBridgeByName(ctx, client, bridgeName)
 	if err != nil {
-		logger.Errorf("[ovs] get bridge by name failed: %v", err)
+		log.Error("get bridge by name failed", logger.KeyErr, err)
 		return err
 	}
-	logger.Debugf("[ovs] target bridge: name=%s uuid=%s", br.Name, br.UUID)
+	log.Debug("target bridge", "bridge_uuid", br.UUID)
 
 	iface, _ := findInterfaceByName(ctx, client, ifName)
 	if iface != nil {
-		logger.Debugf("[ovs] interface exists: %s (uuid=%s)", iface.Name, iface.UUID)
+		log.Debug("interface exists", "iface_uuid", iface.UUID)
 	} else {
-		logger.Debugf("[ovs] interface %s missing; will create", ifName)
+		log.Debug("interface missing; will create")
 	}
 
-	port, _ := findPortByName(ctx, client, ifName)
+	port, _ := findPortByName(ctx, client, logicalPort)
 	if port != nil {
-		logger.Debugf("[ovs] port exists: %s (uuid=%s)", port.Name, port.UUID)
+		log.Debug("port exists", "port_uuid", port.UUID)
 	} else {
-		logger.Debugf("[ovs] interface %s missing; will create", logicalPort)
+		log.Debug("port missing; will create")
 	}
 
 	ops := make([]ovsdb.Operation, 0, 8)
@@ -55,8 +66,14 @@ func EnsureInterfaceOnBridge(ctx context.Context, client client.Client, bridgeNa
 		}
 		ops = append(ops, portOps...)
 
+	} else if iface != nil && port != nil && iface.ExternalIDs["iface-id"] == logicalPort &&
+		slices.Contains(port.Interfaces, iface.UUID) && bridgeHasPort(br, port.UUID) {
+		// Attached by an earlier run, or by an earlier event for the same
+		// port; reconciling a healthy port must not fail.
+		log.Info("interface already on bridge", "port_uuid", port.UUID)
+		return nil
 	} else {
-		logger.Errorf("Interface %s and Port %s already existed already. Consider deleting it", ifName, logicalPort)
+		log.Error("interface and port already exist; consider deleting them")
 		return fmt.Errorf("Interface %s and Port %s already existed", ifName, logicalPort)
 	}
 
@@ -67,37 +84,35 @@ func EnsureInterfaceOnBridge(ctx context.Context, client client.Client, bridgeNa
 	ops = append(ops, bridgeOps...)
 
 	if len(ops) == 0 {
-		logger.Infof("[ovs] no changes needed for if=%s on bridge=%s", ifName, bridgeName)
+		log.Info("no changes needed")
 		return nil
 	}
-	logger.Debugf("[ovs] transact ops count=%d", len(ops))
-	result, err := client.Transact(ctx, ops...)
-	if err != nil {
-		logger.Errorf("[ovs] transact failed: %v", err)
+	log.Debug("transact", "ops", len(ops))
+	if _, err := transact(ctx, client, ops); err != nil {
+		log.Error("ensure interface on bridge failed", logger.KeyErr, err)
 		return err
 	}
 
-	for _, r := range result {
-		if r.Error != "" {
-			err := fmt.Errorf("ovs error: %s (details: %s)", r.Error, r.Details)
-			logger.Errorf("[ovs] ensure interface on bridge error: %v", err)
-			return err
-		}
-	}
-
-	logger.Infof("[ovs] ensured if=%s on bridge=%s in %s", ifName, bridgeName, time.Since(start).Truncate(time.Millisecond))
+	log.Info("ensured interface on bridge", "elapsed", time.Since(start).Truncate(time.Millisecond))
 	return nil
 }
 
-func RemoveInterfaceFromBridge(ctx context.Context, client client.Client, bridgeName, ifName, logicalPort string) error {
+func RemoveInterfaceFromBridge(ctx context.Context, client client.Client, bridgeName, ifName, logicalPort string) (err error) {
 	start := time.Now()
+	ctx, span := tracing.Start(ctx, "ovs.remove_interface",
+		tracing.LogicalPort.String(logicalPort), tracing.IfName.String(ifName), tracing.Bridge.String(bridgeName))
+	defer func() {
+		metrics.ObserveOp(metrics.OpRemoveInterface, start, err)
+		tracing.End(span, err)
+	}()
+	log := log.With(logger.KeyOp, "remove-interface", logger.KeyLogicalPort, logicalPort, logger.KeyIfname, ifName, "bridge", bridgeName)
 
 	br, err := findBridgeByName(ctx, client, bridgeName)
 	if err != nil {
-		logger.Errorf("[ovs] get bridge by name failed: %v", err)
+		log.Error("get bridge by name failed", logger.KeyErr, err)
 		return err
 	}
-	logger.Debugf("[ovs] target bridge: name=%s uuid=%s", br.Name, br.UUID)
+	log.Debug("target bridge", "bridge_uuid", br.UUID)
 
 	// iface, _ := findInterfaceByName(ctx, client, ifName)
 	port, _ := findPortByName(ctx, client, logicalPort)
@@ -105,7 +120,7 @@ func RemoveInterfaceFromBridge(ctx context.Context, client client.Client, bridge
 	ops := make([]ovsdb.Operation, 0, 6)
 
 	if br != nil && port != nil && bridgeHasPort(br, port.UUID) {
-		logger.Debugf("[ovs] detaching port %s from bridge %s", logicalPort, bridgeName)
+		log.Debug("detaching port from bridge", "port_uuid", port.UUID)
 		detachOps, err := buildDetachPortFromBridgeOps(client, br.UUID, port.UUID)
 		if err != nil {
 			return err
@@ -114,17 +129,36 @@ func RemoveInterfaceFromBridge(ctx context.Context, client client.Client, bridge
 	}
 
 	if len(ops) == 0 {
-		logger.Infof("[ovs] no changes need for if=%s on bridge=%s", ifName, bridgeName)
+		log.Info("no changes needed")
 		return nil
 	}
-	logger.Debugf("[ovs] transact ops count=%d", len(ops))
-	result, err := client.Transact(ctx, ops...)
+	log.Debug("transact", "ops", len(ops))
+	result, err := transact(ctx, client, ops)
 	if err != nil {
-		logger.Errorf("[ovs] transact failed: %v", err)
+		log.Error("transact failed", logger.KeyErr, err)
 		return err
 	}
-	logger.Debugf("Result %+v", result)
+	log.Debug("transact result", "result", fmt.Sprintf("%+v", result))
 
-	logger.Infof("[ovs] cleanup done for if=%s in %s", ifName, time.Since(start).Truncate(time.Millisecond))
+	log.Info("cleanup done", "elapsed", time.Since(start).Truncate(time.Millisecond))
 	return nil
 }
+
+// transact runs ops, turns per-operation errors into an error and records the
+// transaction in the audit log.
+func transact(ctx context.Context, client client.Client, ops []ovsdb.Operation) ([]ovsdb.OperationResult, error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "ovsdb.transact", tracing.Ops.Int(len(ops)))
+	result, err := client.Transact(ctx, ops...)
+	if err == nil {
+		for _, r := range result {
+			if r.Error != "" {
+				err = fmt.Errorf("ovs error: %s (details: %s)", r.Error, r.Details)
+				break
+			}
+		}
+	}
+	tracing.End(span, err)
+	audit.Record(ctx, audit.OVSDBTransact, "Open_vSwitch", start, err, audit.Transaction{Ops: ops, Result: result})
+	return result, err
+}
@@ -0,0 +1,95 @@
+package sb
+
+import (
+	"sync"
+	"time"
+)
+
+// dispatcher runs port operations off the OVSDB event goroutine. Operations for
+// the same key run one at a time in submission order; at most limit run at once
+// across keys. The zero value runs one operation at a time.
+type dispatcher struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	running int
+	queues  map[string][]func()  // key present = a goroutine is draining it
+	started map[string]time.Time // keys whose operation is running, and since when
+}
+
+func (d *dispatcher) lazyInit() {
+	if d.cond == nil {
+		d.cond = sync.NewCond(&d.mu)
+		d.queues = make(map[string][]func())
+		d.started = make(map[string]time.Time)
+	}
+	if d.limit <= 0 {
+		d.limit = 1
+	}
+}
+
+// SetLimit changes how many operations may run concurrently.
+func (d *dispatcher) SetLimit(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lazyInit()
+	if n > 0 {
+		d.limit = n
+	}
+	d.cond.Broadcast()
+}
+
+func (d *dispatcher) Submit(key string, fn func()) {
+	d.mu.Lock()
+	d.lazyInit()
+	if q, busy := d.queues[key]; busy {
+		d.queues[key] = append(q, fn)
+		d.mu.Unlock()
+		return
+	}
+	d.queues[key] = nil
+	d.mu.Unlock()
+
+	go d.drain(key, fn)
+}
+
+func (d *dispatcher) drain(key string, fn func()) {
+	for {
+		d.mu.Lock()
+		for d.running >= d.limit {
+			d.cond.Wait()
+		}
+		d.running++
+		d.started[key] = time.Now()
+		d.mu.Unlock()
+
+		fn()
+
+		d.mu.Lock()
+		d.running--
+		delete(d.started, key)
+		d.cond.Signal()
+		q := d.queues[key]
+		if len(q) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		fn, d.queues[key] = q[0], q[1:]
+		d.mu.Unlock()
+	}
+}
+
+// oldest returns the key of the longest-running operation and how long it
+// has been running; key is empty when nothing runs.
+func (d *dispatcher) oldest() (key string, age time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for k, t := range d.started {
+		if a := now.Sub(t); a > age {
+			key, age = k, a
+		}
+	}
+	return key, age
+}
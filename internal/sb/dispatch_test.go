@@ -0,0 +1,125 @@
+package sb
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDispatcherSerializesKey(t *testing.T) {
+	var d dispatcher
+	d.SetLimit(4)
+
+	const n = 50
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		order   []int
+		running atomic.Int32
+	)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		d.Submit("p1", func() {
+			defer wg.Done()
+			if running.Add(1) > 1 {
+				t.Error("two operations on the same key ran at once")
+			}
+			time.Sleep(100 * time.Microsecond)
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			running.Add(-1)
+		})
+	}
+	wg.Wait()
+
+	for i, v := range order {
+		if v != i {
+			t.Fatalf("operations ran in order %v, want submission order", order)
+		}
+	}
+}
+
+func TestDispatcherLimit(t *testing.T) {
+	tests := []struct {
+		limit int // 0 = the zero value's limit of one
+		keys  int
+		want  int
+	}{
+		{limit: 0, keys: 3, want: 1},
+		{limit: 2, keys: 5, want: 2},
+		{limit: 8, keys: 3, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("limit=%d", tt.limit), func(t *testing.T) {
+			var d dispatcher
+			if tt.limit > 0 {
+				d.SetLimit(tt.limit)
+			}
+
+			var wg sync.WaitGroup
+			started := make(chan string, tt.keys)
+			release := make(chan struct{})
+			wg.Add(tt.keys)
+			for i := 0; i < tt.keys; i++ {
+				key := fmt.Sprintf("p%d", i)
+				d.Submit(key, func() {
+					defer wg.Done()
+					started <- key
+					<-release
+				})
+			}
+
+			for i := 0; i < tt.want; i++ {
+				select {
+				case <-started:
+				case <-time.After(5 * time.Second):
+					t.Fatalf("only %d of %d operations started", i, tt.want)
+				}
+			}
+			select {
+			case key := <-started:
+				t.Fatalf("%s started beyond the limit of %d", key, tt.want)
+			case <-time.After(50 * time.Millisecond):
+			}
+			if key, age := d.oldest(); key == "" || age <= 0 {
+				t.Errorf("oldest() = %q, %v while operations run", key, age)
+			}
+
+			close(release)
+			wg.Wait()
+			if key, _ := d.oldest(); key != "" {
+				t.Errorf("oldest() = %q after all operations finished", key)
+			}
+		})
+	}
+}
+
+func TestDispatcherRaiseLimit(t *testing.T) {
+	var d dispatcher
+
+	var wg sync.WaitGroup
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	wg.Add(2)
+	for _, key := range []string{"p1", "p2"} {
+		d.Submit(key, func() {
+			defer wg.Done()
+			started <- struct{}{}
+			<-release
+		})
+	}
+	<-started
+
+	// The second operation waits for the limit until it is raised.
+	d.SetLimit(2)
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("raising the limit did not start the waiting operation")
+	}
+	close(release)
+	wg.Wait()
+}
@@ -2,143 +2,416 @@ package sb
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ovn-kubernetes/libovsdb/cache"
 	"github.com/ovn-kubernetes/libovsdb/client"
 	"github.com/ovn-kubernetes/libovsdb/model"
+	"github.com/yangjie500/cloud-ovs-agent/internal/audit"
+	"github.com/yangjie500/cloud-ovs-agent/internal/metrics"
 	"github.com/yangjie500/cloud-ovs-agent/internal/netdev"
 	"github.com/yangjie500/cloud-ovs-agent/internal/ovs"
+	"github.com/yangjie500/cloud-ovs-agent/internal/tracing"
 	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type PBWatcher struct {
 	Ctx     context.Context
-	SbCli   client.Client
+	SbCli   client.Client // set by ConnectSouthBound
 	OvsCli  client.Client
 	Chassis string // host's chassis/system-id
 	Bridge  string // usually "br-int"
+	Netdev  *netdev.Manager
+	Links   *netdev.LinkWatcher
+	Status  *StatusPublisher // nil = don't publish port status
+
+	// Standalone watchers have no Southbound DB: ports are plugged and
+	// unplugged on request only, without checking a Port_Binding.
+	Standalone bool
+
+	pol  atomic.Pointer[Policy]
+	jobs dispatcher
+	reg  registry
+
+	initMu  sync.Mutex
+	live    bool           // initial dump handed over
+	initial sync.WaitGroup // operations queued for the initial dump
+}
+
+// SetPolicy swaps the per-port policy used for ports plugged from now on.
+func (w *PBWatcher) SetPolicy(p Policy) {
+	w.pol.Store(&p)
+}
+
+func (w *PBWatcher) policy() *Policy {
+	if p := w.pol.Load(); p != nil {
+		return p
+	}
+	return &Policy{MTU: 1500}
+}
+
+// SetWorkers sets how many ports may be plugged or unplugged concurrently.
+func (w *PBWatcher) SetWorkers(n int) {
+	w.jobs.SetLimit(n)
 }
 
 func (w *PBWatcher) checkIsPB(m model.Model) (*PortBinding, bool) {
 	pb, ok := m.(*PortBinding)
 	if !ok || pb == nil || pb.LogicalPort == "" {
-		logger.Infof("[sb] Port Binding does not conform to Port Binding Format")
+		log.Info("Port Binding does not conform to Port Binding Format")
 		return nil, false
 	}
 	return pb, true
 }
 
-func (w *PBWatcher) requestedForThisChassis(pb *PortBinding) bool {
+// agentLog logs the plug/unplug steps; sb's own logger covers the DB side.
+var agentLog = logger.Named("agent")
+
+// pbLogger returns l tagged with the port's identity.
+func pbLogger(l *logger.Logger, pb *PortBinding) *logger.Logger {
+	return l.With(logger.KeyLogicalPort, pb.LogicalPort, logger.KeyDatapath, pb.Datapath)
+}
+
+func (w *PBWatcher) requestedForThisChassis(pb *PortBinding, log *logger.Logger) bool {
 	if pb.Options == nil {
 		// no preference → up to your policy; we choose to allow only explicit matches
-		logger.Debugf("[sb] Port Binding has no requested chassis")
+		log.Debug("Port Binding has no requested chassis")
 		return false
 	}
 	if rc, ok := pb.Options["requested-chassis"]; ok && rc != "" && rc == w.Chassis {
 		return true
 	}
-	logger.Debugf("[sb] Port Binding is not for this requested chassis, Chassis: %s; PortBinding Chassis: %s", w.Chassis, pb.Options["requested-chassis"])
+	log.Debug("Port Binding is not for this chassis", "chassis", w.Chassis, "requested_chassis", pb.Options["requested-chassis"])
 	return false
 }
 
-func RegisterPBHandler(ctx context.Context, sbCli client.Client, ovsCli client.Client, chassis, bridge string) {
-	w := &PBWatcher{Ctx: ctx, SbCli: sbCli, OvsCli: ovsCli, Chassis: chassis, Bridge: bridge}
-	sbCli.Cache().AddEventHandler(&cache.EventHandlerFuncs{
+func (w *PBWatcher) handler() cache.EventHandler {
+	return &cache.EventHandlerFuncs{
 		AddFunc:    w.onAdd,
+		UpdateFunc: w.onUpdate,
 		DeleteFunc: w.onDelete,
+	}
+}
+
+// InitialReconcile marks the initial dump as delivered and waits for the
+// plugs it triggered. Call it once ConnectSouthBound has returned.
+func (w *PBWatcher) InitialReconcile() {
+	w.initMu.Lock()
+	w.live = true
+	w.initMu.Unlock()
+	w.initial.Wait()
+}
+
+// submit queues op for pb's port, tracking it as part of the initial
+// reconcile until InitialReconcile is called. span, the trigger's, ends once
+// op has run, so it covers the operations it is the parent of.
+func (w *PBWatcher) submit(pb *PortBinding, span trace.Span, op func()) {
+	w.initMu.Lock()
+	tracked := !w.live
+	if tracked {
+		w.initial.Add(1)
+	}
+	w.initMu.Unlock()
+
+	w.jobs.Submit(pb.LogicalPort, func() {
+		if tracked {
+			defer w.initial.Done()
+		}
+		defer span.End()
+		op()
 	})
 }
 
 func (w *PBWatcher) onAdd(table string, m model.Model) {
 	if table != "Port_Binding" {
-		logger.Infof("Table is not Port_Binding")
+		log.Debug("ignoring row", "table", table)
 		return
 	}
 	pb, isPb := w.checkIsPB(m)
 	if !isPb {
+		metrics.PBEvent(metrics.EventAdd, metrics.ResultSkipped, "invalid")
 		return
 	}
+	log := pbLogger(log, pb)
+	logPB(log, "Port_Binding added", pb)
 
-	logger.Infof("UUID: %s; logicalPort: %s; type: %s; datapath: %s, tunnelKey: %d, chassis: %s, up: %t; options: %+v",
-		pb.UUID,
-		pb.LogicalPort,
-		pb.Type,
-		pb.Datapath,
-		pb.TunnelKey,
-		valOrNil(pb.Chassis),
-		valOrNil(pb.Up),
-		pb.Options)
+	ctx, span := w.trigger(metrics.EventAdd, pb)
+	if !w.accept(ctx, metrics.EventAdd, pb, log) {
+		span.End()
+		return
+	}
+	w.note(ctx, pb, PortBindingSeen)
+	w.submit(pb, span, func() { record(metrics.EventAdd, w.plug(ctx, pb)) })
+}
 
+// accept reports whether the agent should plug pb, counting skips under event.
+func (w *PBWatcher) accept(ctx context.Context, event string, pb *PortBinding, log *logger.Logger) bool {
+	span := trace.SpanFromContext(ctx)
 	if pb.Type == "patch" {
-		logger.Debugf("[agent] Ignoring router portl; router: %s", pb.LogicalPort)
-		return
+		log.Debug("ignoring router port")
+		metrics.PBEvent(event, metrics.ResultSkipped, "patch")
+		span.SetAttributes(tracing.Skipped.String("patch"))
+		return false
+	}
+
+	_, rcSpan := tracing.Start(ctx, "requested_for_this_chassis",
+		tracing.Chassis.String(w.Chassis), attribute.String("ovn.requested_chassis", pb.Options["requested-chassis"]))
+	here := w.requestedForThisChassis(pb, log)
+	rcSpan.SetAttributes(attribute.Bool("match", here))
+	rcSpan.End()
+	if !here {
+		metrics.PBEvent(event, metrics.ResultSkipped, "other-chassis")
+		span.SetAttributes(tracing.Skipped.String("other-chassis"))
+		return false
 	}
+	return true
+}
+
+// stallTimeout is how long one plug or unplug may run before the agent is
+// reported as not live.
+const stallTimeout = 2 * time.Minute
+
+// CheckStalled fails if a port operation has been running for longer than
+// stallTimeout, e.g. an OVSDB transaction that never completes.
+func (w *PBWatcher) CheckStalled(context.Context) error {
+	if key, age := w.jobs.oldest(); age > stallTimeout {
+		return fmt.Errorf("operation on %s running for %s", key, age.Truncate(time.Second))
+	}
+	return nil
+}
 
-	isForThisChassis := w.requestedForThisChassis(pb)
-	if !isForThisChassis {
+// boundHere is requestedForThisChassis without the logging, plus the patch
+// port check.
+func (w *PBWatcher) boundHere(pb *PortBinding) bool {
+	rc := pb.Options["requested-chassis"]
+	return pb.Type != "patch" && rc != "" && rc == w.Chassis
+}
+
+// onUpdate acts when the requested chassis moves to or away from this host.
+// Other column changes, including the agent's own status keys, are only
+// counted.
+func (w *PBWatcher) onUpdate(table string, old, m model.Model) {
+	if table != "Port_Binding" {
 		return
 	}
+	pb, ok := m.(*PortBinding)
+	if !ok || pb == nil || pb.LogicalPort == "" {
+		metrics.PBEvent(metrics.EventUpdate, metrics.ResultSkipped, "invalid")
+		return
+	}
+	log := pbLogger(log, pb)
+	log.Debug("Port_Binding updated", "uuid", pb.UUID, "chassis", valOrNil(pb.Chassis), "up", valOrNil(pb.Up))
+
+	oldPB, _ := old.(*PortBinding)
+	was := oldPB != nil && w.boundHere(oldPB)
+	if isUp(pb) && (oldPB == nil || !isUp(oldPB)) {
+		if _, managed := w.reg.port(pb.LogicalPort); managed && w.boundHere(pb) {
+			w.reg.note(pb, PortOVNInstalled, metrics.EventUpdate)
+		}
+	}
+	switch is := w.boundHere(pb); {
+	case is && !was:
+		log.Info("Port_Binding requested on this chassis")
+		ctx, span := w.trigger(metrics.EventUpdate, pb)
+		w.note(ctx, pb, PortBindingSeen)
+		w.submit(pb, span, func() { record(metrics.EventUpdate, w.plug(ctx, pb)) })
+	case was && !is:
+		log.Info("Port_Binding requested elsewhere; unbinding", "requested_chassis", pb.Options["requested-chassis"])
+		ctx, span := w.trigger(metrics.EventUpdate, pb)
+		w.submit(pb, span, func() {
+			err := w.unplug(ctx, oldPB)
+			w.Status.Clear(pb)
+			record(metrics.EventUpdate, err)
+		})
+	default:
+		metrics.PBEvent(metrics.EventUpdate, metrics.ResultSkipped, "not-handled")
+	}
+}
+
+// trigger returns the watcher's context tagged with the event behind an
+// operation, for the audit log, and the event's span, the root of the trace
+// for the operations it causes. The span is ended by submit, or by the caller
+// if nothing is submitted.
+func (w *PBWatcher) trigger(event string, pb *PortBinding) (context.Context, trace.Span) {
+	ctx := audit.WithTrigger(w.Ctx, audit.Trigger{Event: event, PortBinding: pb.UUID, LogicalPort: pb.LogicalPort})
+	return tracing.Start(ctx, "sb.port_binding."+event,
+		tracing.LogicalPort.String(pb.LogicalPort), tracing.Datapath.String(pb.Datapath), attribute.String("ovn.port_binding", pb.UUID))
+}
+
+func (w *PBWatcher) plug(ctx context.Context, pb *PortBinding) (err error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "plug", tracing.LogicalPort.String(pb.LogicalPort), tracing.Bridge.String(w.Bridge))
+	w.setState(ctx, pb, PortPlugStarted, StatePlugging, nil)
+	defer func() {
+		metrics.ObserveOp(metrics.OpPlug, start, err)
+		tracing.End(span, err)
+		if err != nil {
+			w.setState(ctx, pb, PortFailed, StateFailed, err)
+		} else {
+			w.setState(ctx, pb, PortPlugged, StatePlugged, nil)
+		}
+	}()
 
 	ifName := pb.LogicalPort
-	if _, err := netdev.CreateTap(ifName, 1500, true); err != nil {
-		logger.Errorf("[agent] create tap %s failed: %v", ifName, err)
-		return
+	log := pbLogger(agentLog, pb).With(logger.KeyOp, "plug", logger.KeyIfname, ifName)
+
+	spec, err := w.vifSpecFor(pb)
+	if err != nil {
+		log.Error("bad VIF options", logger.KeyErr, err)
+		return &stepError{Step: "vif-options", Err: err}
 	}
 
-	if err := ovs.EnsureInterfaceOnBridge(w.Ctx, w.OvsCli, w.Bridge, ifName, pb.LogicalPort); err != nil {
-		logger.Errorf("[agent] ensure OVS for %s failed: %v", pb.LogicalPort, err)
-		return
+	vif, err := w.Netdev.CreateVif(ctx, ifName, spec)
+	if err != nil {
+		switch {
+		case errors.Is(err, netdev.ErrWrongType), errors.Is(err, netdev.ErrExists):
+			log.Error("create VIF failed: name collides with a foreign device", "kind", spec.Kind, logger.KeyErr, err)
+		case errors.Is(err, netdev.ErrPermission):
+			log.Error("create VIF failed: agent lacks CAP_NET_ADMIN", "kind", spec.Kind, logger.KeyErr, err)
+		default:
+			log.Error("create VIF failed", "kind", spec.Kind, logger.KeyErr, err)
+		}
+		return &stepError{Step: "create-vif", Err: err}
 	}
+	w.note(ctx, pb, PortTapCreated)
 
-	if _, err := netdev.SetLinkUp(ifName); err != nil {
-		logger.Errorf("[agent] unable to set link %s up: %v", ifName, err)
-		return
+	if spec.Kind.AttachesToOVS() {
+		if err := ovs.EnsureInterfaceOnBridge(ctx, w.OvsCli, w.Bridge, ifName, pb.LogicalPort); err != nil {
+			log.Error("ensure OVS failed", logger.KeyErr, err)
+			return &stepError{Step: "ovs-attach", Err: err}
+		}
+		w.note(ctx, pb, PortOVSAttached)
+	} else {
+		log.Debug("port bypasses OVS, skipping attachment", "kind", spec.Kind)
 	}
 
-	logger.Infof("[agent] created and link up logical_port=%s if=%s", pb.LogicalPort, ifName)
+	if _, err := w.Netdev.SetLinkUp(ctx, ifName); err != nil {
+		log.Error("unable to set link up", logger.KeyErr, err)
+		return &stepError{Step: "link-up", Err: err}
+	}
+	w.note(ctx, pb, PortLinkUp)
+	w.Links.Manage(ifName, spec)
+
+	log.Info("created and link up", "kind", vif.Kind, "dev", vif.DevicePath)
+	return nil
 }
 
 func (w *PBWatcher) onDelete(table string, m model.Model) {
 	if table != "Port_Binding" {
-		logger.Infof("Table is not Port_Binding")
+		log.Debug("ignoring row", "table", table)
 		return
 	}
 
 	pb, isPb := w.checkIsPB(m)
 	if !isPb {
+		metrics.PBEvent(metrics.EventDelete, metrics.ResultSkipped, "invalid")
 		return
 	}
-
-	logger.Infof("UUID: %s; logicalPort: %s; type: %s; datapath: %s, tunnelKey: %d, chassis: %s, up: %t; options: %+v",
-		pb.UUID,
-		pb.LogicalPort,
-		pb.Type,
-		pb.Datapath,
-		pb.TunnelKey,
-		valOrNil(pb.Chassis),
-		valOrNil(pb.Up),
-		pb.Options)
+	log := pbLogger(log, pb)
+	logPB(log, "Port_Binding deleted", pb)
 
 	if pb.Type == "patch" {
-		logger.Debugf("[agent] Ignoring router portl; router: %s", pb.LogicalPort)
+		log.Debug("ignoring router port")
+		metrics.PBEvent(metrics.EventDelete, metrics.ResultSkipped, "patch")
 		return
 	}
 
+	ctx, span := w.trigger(metrics.EventDelete, pb)
+	w.submit(pb, span, func() {
+		record(metrics.EventDelete, w.unplug(ctx, pb))
+		w.Status.Forget(pb.UUID)
+	})
+}
+
+// unplug carries on past a failed OVS cleanup so the device is still removed;
+// it returns the first error.
+func (w *PBWatcher) unplug(ctx context.Context, pb *PortBinding) (err error) {
+	ctx, span := tracing.Start(ctx, "unplug", tracing.LogicalPort.String(pb.LogicalPort), tracing.Bridge.String(w.Bridge))
+	_, managed := w.reg.port(pb.LogicalPort)
+	defer func() {
+		tracing.End(span, err)
+		switch {
+		case err != nil:
+			w.setState(ctx, pb, PortFailed, StateFailed, err)
+		case managed:
+			w.setState(ctx, pb, PortUnplugged, StateUnplugged, nil)
+		}
+	}()
+
 	ifName := pb.LogicalPort
+	log := pbLogger(agentLog, pb).With(logger.KeyOp, "unplug", logger.KeyIfname, ifName)
+	w.Links.Unmanage(ifName)
 
-	if err := ovs.RemoveInterfaceFromBridge(w.Ctx, w.OvsCli, w.Bridge, ifName, pb.LogicalPort); err != nil {
-		logger.Errorf("[agent] cleanup %s failed: %v", ifName, err)
+	var firstErr error
+	if kind, err := vifKind(pb); err != nil || kind.AttachesToOVS() {
+		if err := ovs.RemoveInterfaceFromBridge(ctx, w.OvsCli, w.Bridge, ifName, pb.LogicalPort); err != nil {
+			log.Error("OVS cleanup failed", logger.KeyErr, err)
+			firstErr = &stepError{Step: "ovs-detach", Err: err}
+		}
 	}
 
-	if err := netdev.SetLinkDown(ifName); err != nil {
-		logger.Errorf("[agent] unable to set link %s up: %v", ifName, err)
-		return
+	if err := w.Netdev.SetLinkDown(ctx, ifName); err != nil {
+		if errors.Is(err, netdev.ErrNotFound) {
+			log.Info("link already gone")
+			return firstErr
+		}
+		log.Error("unable to set link down", logger.KeyErr, err)
+		return errors.Join(firstErr, &stepError{Step: "link-down", Err: err})
+	}
+	if err := w.Netdev.DeleteLink(ctx, ifName); err != nil {
+		log.Warn("delete link failed", logger.KeyErr, err)
+		if firstErr == nil {
+			firstErr = &stepError{Step: "delete-link", Err: err}
+		}
+	}
+
+	log.Info("cleaned up")
+	return firstErr
+}
+
+// stepError records which plug/unplug step failed.
+type stepError struct {
+	Step string
+	Err  error
+}
+
+func (e *stepError) Error() string { return e.Step + ": " + e.Err.Error() }
+func (e *stepError) Unwrap() error { return e.Err }
+
+func failedStep(err error) string {
+	var se *stepError
+	if errors.As(err, &se) {
+		return se.Step
 	}
-	if err := netdev.DeleteLink(ifName); err != nil {
-		logger.Warnf("[agent] delete link %s: %v", ifName, err)
+	return "unknown"
+}
+
+func record(event string, err error) {
+	if err != nil {
+		metrics.PBEvent(event, metrics.ResultFailed, failedStep(err))
+		return
 	}
+	metrics.PBEvent(event, metrics.ResultHandled, "")
+}
+
+func logPB(log *logger.Logger, msg string, pb *PortBinding) {
+	log.Info(msg,
+		"uuid", pb.UUID,
+		"type", pb.Type,
+		"tunnel_key", pb.TunnelKey,
+		"chassis", valOrNil(pb.Chassis),
+		"up", valOrNil(pb.Up),
+		"options", pb.Options)
+}
 
-	logger.Infof("[agent] cleaned up logical_port=%s if=%s", pb.LogicalPort, ifName)
+func isUp(pb *PortBinding) bool {
+	return pb.Up != nil && *pb.Up
 }
 
 func valOrNil[T any](p *T) any {
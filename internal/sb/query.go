@@ -0,0 +1,53 @@
+package sb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ovn-kubernetes/libovsdb/client"
+	"github.com/yangjie500/cloud-ovs-agent/internal/netdev"
+)
+
+// RequestedChassis is the chassis the CMS asked to bind pb on, if any.
+func (pb *PortBinding) RequestedChassis() string {
+	return pb.Options["requested-chassis"]
+}
+
+// VifKind is the device type pb asks for.
+func (pb *PortBinding) VifKind() (netdev.Kind, error) {
+	return vifKind(pb)
+}
+
+// FindBinding returns the Port_Binding for logicalPort from cli's cache, or
+// ErrPortNotFound.
+func FindBinding(ctx context.Context, cli client.Client, logicalPort string) (*PortBinding, error) {
+	var pbs []PortBinding
+	err := cli.WhereCache(func(pb *PortBinding) bool { return pb.LogicalPort == logicalPort }).List(ctx, &pbs)
+	if err != nil {
+		return nil, fmt.Errorf("list Port_Binding: %w", err)
+	}
+	if len(pbs) == 0 {
+		return nil, ErrPortNotFound
+	}
+	return &pbs[0], nil
+}
+
+// RequestedOn returns the Port_Bindings requested on chassis from cli's cache.
+func RequestedOn(ctx context.Context, cli client.Client, chassis string) ([]PortBinding, error) {
+	var pbs []PortBinding
+	err := cli.WhereCache(func(pb *PortBinding) bool { return pb.RequestedChassis() == chassis }).List(ctx, &pbs)
+	if err != nil {
+		return nil, fmt.Errorf("list Port_Binding: %w", err)
+	}
+	return pbs, nil
+}
+
+// ChassisName resolves a Chassis row UUID to the chassis name. It returns
+// uuid itself if the row is not in cli's cache.
+func ChassisName(ctx context.Context, cli client.Client, uuid string) string {
+	ch := &Chassis{UUID: uuid}
+	if err := cli.Get(ctx, ch); err != nil {
+		return uuid
+	}
+	return ch.Name
+}
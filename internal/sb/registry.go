@@ -0,0 +1,408 @@
+package sb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/hub"
+	"github.com/yangjie500/cloud-ovs-agent/internal/audit"
+	"github.com/yangjie500/cloud-ovs-agent/internal/metrics"
+	"github.com/yangjie500/cloud-ovs-agent/internal/netdev"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+)
+
+const (
+	historyLen = 32   // events kept per port
+	journalLen = 1024 // events kept across ports
+)
+
+// EventType is a step in a port's life as seen by the agent.
+type EventType string
+
+const (
+	PortBindingSeen  EventType = "binding_seen" // a Port_Binding is requested on this chassis
+	PortPlugStarted  EventType = "plug_started"
+	PortTapCreated   EventType = "tap_created" // the device exists, whatever its kind
+	PortOVSAttached  EventType = "ovs_attached"
+	PortLinkUp       EventType = "link_up"
+	PortPlugged      EventType = "plugged"
+	PortOVNInstalled EventType = "ovn_installed" // ovn-controller marked the binding up
+	PortFailed       EventType = "failed"
+	PortUnplugged    EventType = "unplugged"
+	PortLinkChanged  EventType = "link_changed"  // the device changed outside the agent
+	PortLinkRepaired EventType = "link_repaired" // ... and the agent changed it back
+)
+
+// Event is one entry of the agent's port journal.
+type Event struct {
+	Seq         uint64
+	Time        time.Time
+	Type        EventType
+	LogicalPort string
+	Datapath    string
+	Trigger     string // add, update, delete, reconcile, ...
+	Detail      string // what changed, for link events
+	Error       string
+}
+
+// eventKind is the hub.Kind of every Event.
+const eventKind hub.Kind = 0
+
+func (Event) Kind() hub.Kind { return eventKind }
+
+// ManagedPort is a port the agent has plugged, or tried to.
+type ManagedPort struct {
+	PortBinding PortBinding // as of the last plug or unplug
+	IfName      string
+	State       PortState
+	Since       time.Time
+	LastError   string
+	History     []Event // oldest first
+}
+
+// ErrPortNotFound is returned for a logical port that is neither bound to
+// this chassis nor managed by the agent.
+var ErrPortNotFound = errors.New("port not found")
+
+// registry tracks managed ports and journals their events, publishing each
+// on hub. The zero value is ready to use.
+type registry struct {
+	mu      sync.Mutex
+	ports   map[string]*ManagedPort // by logical port
+	journal []Event                 // oldest first
+	seq     uint64
+	hub     hub.Hub
+}
+
+// record journals typ for pb and moves the port to state; an unplugged port
+// is forgotten.
+func (r *registry) record(pb *PortBinding, typ EventType, state PortState, trigger string, err error) Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ev := r.append(pb, typ, trigger, "", err)
+	if state == StateUnplugged {
+		delete(r.ports, pb.LogicalPort)
+		return ev
+	}
+	if r.ports == nil {
+		r.ports = make(map[string]*ManagedPort)
+	}
+	p, ok := r.ports[pb.LogicalPort]
+	if !ok {
+		p = &ManagedPort{IfName: netdev.IfName(pb.LogicalPort)}
+		r.ports[pb.LogicalPort] = p
+	}
+	p.PortBinding = *pb
+	if p.State != state {
+		p.State, p.Since = state, ev.Time
+	}
+	if err != nil {
+		p.LastError = ev.Error
+	}
+	p.addHistory(ev)
+	return ev
+}
+
+// note journals a step that leaves the port's state as it is.
+func (r *registry) note(pb *PortBinding, typ EventType, trigger string) Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ev := r.append(pb, typ, trigger, "", nil)
+	if p, ok := r.ports[pb.LogicalPort]; ok {
+		p.addHistory(ev)
+	}
+	return ev
+}
+
+// noteLink journals a change to the device of the managed port named ifName.
+// It reports false if no managed port has that device.
+func (r *registry) noteLink(ifName string, typ EventType, detail string, err error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.ports {
+		if p.IfName == ifName {
+			p.addHistory(r.append(&p.PortBinding, typ, "link", detail, err))
+			return true
+		}
+	}
+	return false
+}
+
+// append numbers, journals and publishes an event. Publishing under r.mu
+// keeps subscribers in journal order.
+func (r *registry) append(pb *PortBinding, typ EventType, trigger, detail string, err error) Event {
+	r.seq++
+	ev := Event{
+		Seq:         r.seq,
+		Time:        time.Now(),
+		Type:        typ,
+		LogicalPort: pb.LogicalPort,
+		Datapath:    pb.Datapath,
+		Trigger:     trigger,
+		Detail:      detail,
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	if len(r.journal) == journalLen {
+		r.journal = append(r.journal[:0], r.journal[1:]...)
+	}
+	r.journal = append(r.journal, ev)
+	r.hub.Publish(ev)
+	return ev
+}
+
+func (p *ManagedPort) addHistory(ev Event) {
+	if len(p.History) == historyLen {
+		p.History = append(p.History[:0], p.History[1:]...)
+	}
+	p.History = append(p.History, ev)
+}
+
+func (r *registry) port(logicalPort string) (ManagedPort, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.ports[logicalPort]
+	if !ok {
+		return ManagedPort{}, false
+	}
+	return p.copy(), true
+}
+
+func (r *registry) list() []ManagedPort {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]ManagedPort, 0, len(r.ports))
+	for _, p := range r.ports {
+		out = append(out, p.copy())
+	}
+	return out
+}
+
+// events returns up to limit of the latest events, oldest first; limit <= 0
+// returns all that are kept.
+func (r *registry) events(limit int) []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	evs := r.journal
+	if limit > 0 && len(evs) > limit {
+		evs = evs[len(evs)-limit:]
+	}
+	return append([]Event(nil), evs...)
+}
+
+// subscribe returns the journaled events after *since, if since is set, and
+// passes every later event to f until cancel is called. lost reports that
+// some events after *since are no longer kept, or were journaled by an
+// earlier run of the agent. f is called with r.mu held and must not block.
+func (r *registry) subscribe(since *uint64, f func(Event)) (backlog []Event, lost bool, cancel func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if since != nil {
+		after := *since
+		if after > r.seq {
+			// A sequence number from an earlier run; replay all of this one.
+			after, lost = 0, true
+		}
+		for _, ev := range r.journal {
+			if ev.Seq > after {
+				backlog = append(backlog, ev)
+			}
+		}
+		if len(r.journal) > 0 && r.journal[0].Seq > after+1 {
+			lost = true
+		}
+	}
+	cancel = r.hub.Subscribe(eventKind, func(e hub.Event) { f(e.(Event)) })
+	return backlog, lost, cancel
+}
+
+func (p *ManagedPort) copy() ManagedPort {
+	c := *p
+	c.History = append([]Event(nil), p.History...)
+	return c
+}
+
+// setState records a port state change in the registry and the published
+// status. The trigger comes from ctx.
+func (w *PBWatcher) setState(ctx context.Context, pb *PortBinding, typ EventType, state PortState, err error) {
+	w.reg.record(pb, typ, state, triggerOf(ctx), err)
+	// An unplugged port has no status: whoever unplugged it clears the keys
+	// if the binding is still there, or forgets them if it is gone.
+	if state != StateUnplugged {
+		w.Status.Set(pb, state, err)
+	}
+}
+
+// note journals a step of pb's plug. The trigger comes from ctx.
+func (w *PBWatcher) note(ctx context.Context, pb *PortBinding, typ EventType) {
+	w.reg.note(pb, typ, triggerOf(ctx))
+}
+
+// OnLinkEvent journals drift and repairs of a managed port's device, for use
+// as the LinkWatcher's OnEvent.
+func (w *PBWatcher) OnLinkEvent(ev netdev.LinkEvent) {
+	typ := PortLinkChanged
+	if ev.Repaired {
+		typ = PortLinkRepaired
+	}
+	if !w.reg.noteLink(ev.Name, typ, ev.String(), ev.Err) {
+		log.Debug("link event for a device no port is managed with", logger.KeyIfname, ev.Name, "event", string(ev.Kind))
+	}
+}
+
+func triggerOf(ctx context.Context) string {
+	if t, ok := audit.TriggerFrom(ctx); ok {
+		return t.Event
+	}
+	return ""
+}
+
+// Ports returns the ports the agent manages.
+func (w *PBWatcher) Ports() []ManagedPort {
+	return w.reg.list()
+}
+
+// Port returns a managed port by logical port name.
+func (w *PBWatcher) Port(logicalPort string) (ManagedPort, bool) {
+	return w.reg.port(logicalPort)
+}
+
+// Events returns up to limit of the latest port events, oldest first.
+func (w *PBWatcher) Events(limit int) []Event {
+	return w.reg.events(limit)
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind by before
+// it is dropped.
+const subscriberBuffer = 256
+
+// Subscription delivers port events as the agent records them.
+type Subscription struct {
+	Backlog []Event      // journaled events after the requested sequence number, oldest first
+	Lost    bool         // some events after that sequence number are no longer kept
+	C       <-chan Event // closed if the subscriber falls subscriberBuffer events behind
+
+	ch     chan Event
+	once   sync.Once
+	cancel func()
+}
+
+// Subscribe starts delivering new port events on the subscription's C. If
+// since is set, the events journaled after it come first, in Backlog. Close
+// the subscription when done.
+func (w *PBWatcher) Subscribe(since *uint64) *Subscription {
+	s := &Subscription{ch: make(chan Event, subscriberBuffer)}
+	s.C = s.ch
+	dropped := false
+	s.Backlog, s.Lost, s.cancel = w.reg.subscribe(since, func(ev Event) {
+		if dropped {
+			return
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			dropped = true
+			s.closeCh()
+		}
+	})
+	return s
+}
+
+// Close stops the subscription and closes C.
+func (s *Subscription) Close() {
+	s.cancel()
+	s.closeCh()
+}
+
+func (s *Subscription) closeCh() {
+	s.once.Do(func() { close(s.ch) })
+}
+
+// Binding returns the Port_Binding for logicalPort from the SB cache.
+func (w *PBWatcher) Binding(ctx context.Context, logicalPort string) (*PortBinding, error) {
+	if w.SbCli == nil {
+		return nil, errors.New("southbound not connected")
+	}
+	return FindBinding(ctx, w.SbCli, logicalPort)
+}
+
+// ChassisName resolves a Chassis row UUID, e.g. Port_Binding chassis, to the
+// chassis name. It returns uuid itself if the row is not in the cache.
+func (w *PBWatcher) ChassisName(ctx context.Context, uuid string) string {
+	if w.SbCli == nil {
+		return uuid
+	}
+	return ChassisName(ctx, w.SbCli, uuid)
+}
+
+// Reconciled lists the logical ports a reconcile queued work for.
+type Reconciled struct {
+	Plug   []string
+	Unplug []string
+}
+
+// Reconcile re-runs plug for logicalPort, or for every port bound to this
+// chassis if logicalPort is empty, and unplugs managed ports that are no
+// longer bound here. Plugging is idempotent, so a healthy port is left as is.
+// The work is queued behind any pending operation on the same port.
+func (w *PBWatcher) Reconcile(ctx context.Context, logicalPort string) (Reconciled, error) {
+	if w.SbCli == nil {
+		return Reconciled{}, errors.New("southbound not connected")
+	}
+	var pbs []PortBinding
+	err := w.SbCli.WhereCache(func(pb *PortBinding) bool {
+		return logicalPort == "" || pb.LogicalPort == logicalPort
+	}).List(ctx, &pbs)
+	if err != nil {
+		return Reconciled{}, fmt.Errorf("list Port_Binding: %w", err)
+	}
+
+	var res Reconciled
+	bound := make(map[string]bool, len(pbs))
+	inSB := make(map[string]bool, len(pbs))
+	for i := range pbs {
+		pb := &pbs[i]
+		inSB[pb.UUID] = true
+		if !w.boundHere(pb) {
+			continue
+		}
+		bound[pb.LogicalPort] = true
+		res.Plug = append(res.Plug, pb.LogicalPort)
+		ctx, span := w.trigger(metrics.EventReconcile, pb)
+		w.submit(pb, span, func() { record(metrics.EventReconcile, w.plug(ctx, pb)) })
+	}
+	for _, p := range w.reg.list() {
+		if bound[p.PortBinding.LogicalPort] || (logicalPort != "" && p.PortBinding.LogicalPort != logicalPort) {
+			continue
+		}
+		pb := p.PortBinding
+		res.Unplug = append(res.Unplug, pb.LogicalPort)
+		ctx, span := w.trigger(metrics.EventReconcile, &pb)
+		w.submit(&pb, span, func() {
+			err := w.unplug(ctx, &pb)
+			switch {
+			case err != nil:
+				// Keep the failed status setState published.
+			case inSB[pb.UUID]:
+				w.Status.Clear(&pb)
+			default:
+				w.Status.Forget(pb.UUID)
+			}
+			record(metrics.EventReconcile, err)
+		})
+	}
+
+	if logicalPort != "" && len(res.Plug) == 0 && len(res.Unplug) == 0 {
+		return res, ErrPortNotFound
+	}
+	agentLog.Info("reconcile requested", "port", logicalPort, "plug", len(res.Plug), "unplug", len(res.Unplug))
+	return res, nil
+}
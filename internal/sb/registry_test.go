@@ -0,0 +1,219 @@
+package sb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yangjie500/cloud-ovs-agent/internal/netdev"
+)
+
+// recordN journals n events for port p1, alternating state changes and
+// notes.
+func recordN(r *registry, n int) {
+	pb := &PortBinding{LogicalPort: "p1", Datapath: "dp1"}
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			r.record(pb, PortPlugged, StatePlugged, "add", nil)
+		} else {
+			r.note(pb, PortLinkUp, "add")
+		}
+	}
+}
+
+func ptr(n uint64) *uint64 { return &n }
+
+func TestRegistrySubscribeBacklog(t *testing.T) {
+	tests := []struct {
+		name      string
+		recorded  int
+		since     *uint64
+		wantFirst uint64 // first backlog sequence number; 0 = no backlog
+		wantLen   int
+		wantLost  bool
+	}{
+		{name: "no since", recorded: 5, since: nil},
+		{name: "after since", recorded: 5, since: ptr(2), wantFirst: 3, wantLen: 3},
+		{name: "since zero replays all", recorded: 5, since: ptr(0), wantFirst: 1, wantLen: 5},
+		{name: "up to date", recorded: 5, since: ptr(5)},
+		{name: "since from an earlier run", recorded: 5, since: ptr(9), wantFirst: 1, wantLen: 5, wantLost: true},
+		{name: "earlier run, nothing journaled yet", recorded: 0, since: ptr(9), wantLost: true},
+		{
+			name:      "journal rotated past since",
+			recorded:  journalLen + 10,
+			since:     ptr(5),
+			wantFirst: 11,
+			wantLen:   journalLen,
+			wantLost:  true,
+		},
+		{
+			name:      "journal rotated up to since",
+			recorded:  journalLen + 10,
+			since:     ptr(10),
+			wantFirst: 11,
+			wantLen:   journalLen,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r registry
+			recordN(&r, tt.recorded)
+
+			backlog, lost, cancel := r.subscribe(tt.since, func(Event) {})
+			defer cancel()
+
+			if lost != tt.wantLost {
+				t.Errorf("lost = %v, want %v", lost, tt.wantLost)
+			}
+			if len(backlog) != tt.wantLen {
+				t.Fatalf("backlog has %d events, want %d", len(backlog), tt.wantLen)
+			}
+			for i, ev := range backlog {
+				if want := tt.wantFirst + uint64(i); ev.Seq != want {
+					t.Fatalf("backlog[%d].Seq = %d, want %d", i, ev.Seq, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistrySubscribeLive(t *testing.T) {
+	var r registry
+	recordN(&r, 3)
+
+	var got []uint64
+	_, _, cancel := r.subscribe(ptr(3), func(ev Event) { got = append(got, ev.Seq) })
+	recordN(&r, 2)
+	cancel()
+	recordN(&r, 1)
+
+	if len(got) != 2 || got[0] != 4 || got[1] != 5 {
+		t.Errorf("delivered %v, want [4 5]", got)
+	}
+}
+
+func TestSubscriptionSlowSubscriberDropped(t *testing.T) {
+	var w PBWatcher
+	s := w.Subscribe(nil)
+	defer s.Close()
+
+	recordN(&w.reg, subscriberBuffer+10)
+
+	n := 0
+	for ev := range s.C {
+		n++
+		if ev.Seq != uint64(n) {
+			t.Fatalf("event %d has Seq %d", n, ev.Seq)
+		}
+	}
+	if n != subscriberBuffer {
+		t.Errorf("received %d events before C closed, want %d", n, subscriberBuffer)
+	}
+
+	// Later events are not delivered and do not panic on the closed channel.
+	recordN(&w.reg, 1)
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	var w PBWatcher
+	recordN(&w.reg, 2)
+	s := w.Subscribe(ptr(1))
+	if len(s.Backlog) != 1 || s.Backlog[0].Seq != 2 || s.Lost {
+		t.Fatalf("backlog %v, lost %v; want [2], false", s.Backlog, s.Lost)
+	}
+
+	recordN(&w.reg, 1)
+	if ev := <-s.C; ev.Seq != 3 {
+		t.Errorf("got Seq %d, want 3", ev.Seq)
+	}
+
+	s.Close()
+	recordN(&w.reg, 1)
+	if _, ok := <-s.C; ok {
+		t.Error("C delivered an event after Close")
+	}
+	s.Close()
+}
+
+func TestRegistryNoteLink(t *testing.T) {
+	var r registry
+	pb := &PortBinding{LogicalPort: "vm1_eth0", Datapath: "dp1"}
+	r.record(pb, PortPlugged, StatePlugged, "add", nil)
+
+	if r.noteLink("other", PortLinkChanged, "deleted", nil) {
+		t.Error("noteLink matched a device no port is managed with")
+	}
+	if !r.noteLink("vm1-eth0", PortLinkChanged, "mtu-changed to 9000 (want 1500)", nil) {
+		t.Fatal("noteLink did not match the port's device")
+	}
+
+	p, _ := r.port("vm1_eth0")
+	ev := p.History[len(p.History)-1]
+	if ev.Type != PortLinkChanged || ev.Trigger != "link" || ev.Detail != "mtu-changed to 9000 (want 1500)" || ev.Datapath != "dp1" {
+		t.Errorf("journaled %+v", ev)
+	}
+	if p.State != StatePlugged {
+		t.Errorf("state = %s, want it left at %s", p.State, StatePlugged)
+	}
+}
+
+func TestReconcileUnplugStatus(t *testing.T) {
+	moved := &PortBinding{
+		LogicalPort: "p1",
+		Datapath:    "5d8a37a4-2f3c-4c1e-9a64-0b8f1c2d3e4f",
+		Options:     map[string]string{"requested-chassis": "hv2", optVifKind: "ipvlan"},
+	}
+	cli, _ := newTestSB(t, moved)
+
+	nd, err := netdev.NewManager("")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer nd.Close()
+	w := PBWatcher{
+		Ctx:     context.Background(),
+		SbCli:   cli,
+		Chassis: "hv1",
+		Netdev:  nd,
+		Links:   netdev.NewLinkWatcher(nd, false, nil),
+		Status:  NewStatusPublisher("hv1", time.Minute),
+	}
+
+	// Both ports were plugged here: p1 has since moved to hv2, p2's
+	// binding was deleted while the agent was not looking.
+	gone := &PortBinding{UUID: "0f6f2c1e-8a3b-4d5e-9c7a-1b2c3d4e5f60", LogicalPort: "p2", Options: map[string]string{optVifKind: "ipvlan"}}
+	for _, pb := range []*PortBinding{moved, gone} {
+		w.reg.record(pb, PortPlugged, StatePlugged, "add", nil)
+		w.Status.Set(pb, StatePlugged, nil)
+	}
+
+	res, err := w.Reconcile(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Plug) != 0 || len(res.Unplug) != 2 {
+		t.Fatalf("reconcile = %+v, want p1 and p2 unplugged", res)
+	}
+
+	pending := func() (p1 statusUpdate, p1ok, p2ok bool) {
+		w.Status.mu.Lock()
+		defer w.Status.mu.Unlock()
+		p1, p1ok = w.Status.pending[moved.UUID]
+		_, p2ok = w.Status.pending[gone.UUID]
+		return
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		p1, p1ok, p2ok := pending()
+		if p1ok && p1.state == "" && !p2ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pending p1 = %+v (%v), p2 present = %v; want p1 cleared and p2 forgotten", p1, p1ok, p2ok)
+		}
+	}
+	for _, lp := range []string{"p1", "p2"} {
+		if _, ok := w.reg.port(lp); ok {
+			t.Errorf("%s is still managed after the unplug", lp)
+		}
+	}
+}
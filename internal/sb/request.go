@@ -0,0 +1,100 @@
+package sb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/yangjie500/cloud-ovs-agent/internal/metrics"
+)
+
+// Errors from RequestPlug and RequestUnplug that say why a request was
+// refused.
+var (
+	ErrNotRequestedHere = errors.New("port is not requested on this chassis")
+	ErrStillRequested   = errors.New("port is still requested on this chassis")
+	ErrNotStandalone    = errors.New("port details can only be given to a standalone agent")
+)
+
+// RequestPlug queues a plug of pb.LogicalPort down the same path as a new
+// Port_Binding. The binding is read from the SB cache and must be requested
+// on this chassis; a standalone watcher has no binding to read and plugs pb
+// as given, of which only LogicalPort, Datapath and Options are used.
+//
+// The returned channel receives the plug's result once it has run.
+func (w *PBWatcher) RequestPlug(ctx context.Context, pb PortBinding) (<-chan error, error) {
+	if !w.Standalone {
+		if pb.Datapath != "" || len(pb.Options) > 0 {
+			return nil, ErrNotStandalone
+		}
+		found, err := w.Binding(ctx, pb.LogicalPort)
+		if err != nil {
+			return nil, err
+		}
+		pb = *found
+	} else {
+		pb = PortBinding{LogicalPort: pb.LogicalPort, Datapath: pb.Datapath, Options: pb.Options}
+	}
+	log := pbLogger(log, &pb)
+
+	tctx, span := w.trigger(metrics.EventPlugRequest, &pb)
+	if !w.Standalone && !w.accept(tctx, metrics.EventPlugRequest, &pb, log) {
+		span.End()
+		if pb.Type == "patch" {
+			return nil, fmt.Errorf("%w: router ports are never plugged", ErrNotRequestedHere)
+		}
+		return nil, fmt.Errorf("%w: requested-chassis is %q, this chassis is %q", ErrNotRequestedHere, pb.RequestedChassis(), w.Chassis)
+	}
+
+	log.Info("plug requested")
+	done := make(chan error, 1)
+	w.submit(&pb, span, func() {
+		err := w.plug(tctx, &pb)
+		record(metrics.EventPlugRequest, err)
+		done <- err
+	})
+	return done, nil
+}
+
+// RequestUnplug queues an unplug of logicalPort. Unless the watcher is
+// standalone, the port's binding must be gone or requested elsewhere, or the
+// next reconcile would plug it again. A port the agent does not manage and
+// the SB cache does not know fails with ErrPortNotFound.
+//
+// The returned channel receives the unplug's result once it has run.
+func (w *PBWatcher) RequestUnplug(ctx context.Context, logicalPort string) (<-chan error, error) {
+	mp, managed := w.reg.port(logicalPort)
+	pb, known := mp.PortBinding, managed
+	inSB := false
+	if !w.Standalone {
+		found, err := w.Binding(ctx, logicalPort)
+		switch {
+		case err == nil && w.boundHere(found):
+			return nil, ErrStillRequested
+		case err == nil:
+			pb, known, inSB = *found, true, true
+		case !errors.Is(err, ErrPortNotFound):
+			return nil, err
+		}
+	}
+	if !known {
+		return nil, ErrPortNotFound
+	}
+	log := pbLogger(log, &pb)
+
+	tctx, span := w.trigger(metrics.EventUnplugRequest, &pb)
+
+	log.Info("unplug requested")
+	done := make(chan error, 1)
+	w.submit(&pb, span, func() {
+		err := w.unplug(tctx, &pb)
+		if inSB {
+			w.Status.Clear(&pb)
+		} else {
+			w.Status.Forget(pb.UUID)
+		}
+		record(metrics.EventUnplugRequest, err)
+		done <- err
+	})
+	return done, nil
+}
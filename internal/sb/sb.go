@@ -2,39 +2,127 @@ package sb
 
 import (
 	"context"
+	"strings"
 	"time"
 
+	"github.com/cenkalti/backoff/v4"
+	"github.com/ovn-kubernetes/libovsdb/cache"
 	"github.com/ovn-kubernetes/libovsdb/client"
 	"github.com/ovn-kubernetes/libovsdb/model"
+	"github.com/ovn-kubernetes/libovsdb/ovsdb"
+	"github.com/yangjie500/cloud-ovs-agent/internal/monitor"
 	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
 )
 
-func ConnectSouthBound(ctx context.Context, endpoint string) (client.Client, error) {
+var log = logger.Named("sb")
+
+// ConnectSouthBound connects to the first reachable endpoint of the OVN
+// Southbound DB (or cluster) and starts monitoring it. If pbw is non-nil it
+// is bound to the client and gets Port_Binding events, starting with the
+// initial dump. ConnectSouthBound returns once that dump is in the cache and
+// has been delivered. The client reconnects on its own; extra options (e.g.
+// client.WithTLSConfig for ssl: endpoints or client.WithLeaderOnly) are passed
+// through to libovsdb.
+func ConnectSouthBound(ctx context.Context, endpoints []string, pbw *PBWatcher, opts ...client.Option) (client.Client, error) {
+	start := time.Now()
+	sb, log, err := dial(ctx, endpoints, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var handlers []cache.EventHandler
+	if pbw != nil {
+		pbw.SbCli = sb
+		handlers = append(handlers, pbw.handler())
+	}
+	if err := monitor.Start(ctx, sb, monitor.DefaultTimeout, handlers...); err != nil {
+		log.Error("initial monitor sync failed", logger.KeyErr, err)
+		sb.Close()
+		return nil, err
+	}
+
+	log.Info("initial monitor sync done", "elapsed", time.Since(start).Truncate(time.Millisecond))
+
+	return sb, nil
+}
+
+// ConnectSouthBoundFor connects like ConnectSouthBound but only monitors the
+// Chassis table and the Port_Bindings requested on chassis, or, if
+// logicalPort is set, that one Port_Binding wherever it is requested. It
+// suits one-off readers such as the status and explain commands, which have
+// no use for the rest of the Southbound DB.
+func ConnectSouthBoundFor(ctx context.Context, endpoints []string, chassis, logicalPort string, opts ...client.Option) (client.Client, error) {
 	start := time.Now()
-	logger.Infof("[sb] connecting to OVN_Southbound endpoint=%s", endpoint)
+	sb, log, err := dial(ctx, endpoints, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := monitor.StartTables(ctx, sb, monitor.DefaultTimeout, tablesFor(chassis, logicalPort)); err != nil {
+		log.Error("initial monitor sync failed", logger.KeyErr, err)
+		sb.Close()
+		return nil, err
+	}
+
+	log.Info("initial monitor sync done", "chassis", chassis, "port", logicalPort, "elapsed", time.Since(start).Truncate(time.Millisecond))
+
+	return sb, nil
+}
+
+// tablesFor selects what ConnectSouthBoundFor monitors. OVSDB ANDs the
+// conditions on a table, so it is either the chassis or the port.
+func tablesFor(chassis, logicalPort string) []client.MonitorOption {
+	pb := &PortBinding{}
+	cond := model.Condition{Field: &pb.Options, Function: ovsdb.ConditionIncludes, Value: map[string]string{"requested-chassis": chassis}}
+	if logicalPort != "" {
+		cond = model.Condition{Field: &pb.LogicalPort, Function: ovsdb.ConditionEqual, Value: logicalPort}
+	}
+	return []client.MonitorOption{
+		client.WithConditionalTable(pb, []model.Condition{cond}),
+		client.WithTable(&Chassis{}),
+	}
+}
+
+// dial builds the Southbound client and connects it, without monitoring
+// anything yet. The returned logger carries the endpoints.
+func dial(ctx context.Context, endpoints []string, opts []client.Option) (client.Client, *logger.Logger, error) {
+	start := time.Now()
+	lr := log.Logr() // libovsdb adds its own endpoint fields
+	log := log.With("endpoints", strings.Join(endpoints, ","))
+	log.Info("connecting to OVN_Southbound")
 
 	dbModel, err := model.NewClientDBModel("OVN_Southbound", map[string]model.Model{
-		"Port_Binding": &PortBinding{},
+		"Port_Binding":     &PortBinding{},
+		"Datapath_Binding": &DatapathBinding{},
+		"Chassis":          &Chassis{},
 	})
 	if err != nil {
-		logger.Errorf("[sb] build ClientDBModel failed: %v", err)
-		return nil, err
+		log.Error("build ClientDBModel failed", logger.KeyErr, err)
+		return nil, nil, err
 	}
 
-	logger.Debugf("[sb] ClientDBModel ready (tables: Port_Binding)")
+	log.Debug("ClientDBModel ready", "tables", "Port_Binding,Datapath_Binding,Chassis")
 
-	sb, err := client.NewOVSDBClient(dbModel, client.WithEndpoint(endpoint))
+	base := []client.Option{
+		client.WithReconnect(30*time.Second, backoff.NewExponentialBackOff()),
+		client.WithLogger(&lr),
+	}
+	for _, ep := range endpoints {
+		base = append(base, client.WithEndpoint(ep))
+	}
+	opts = append(base, opts...)
+	sb, err := client.NewOVSDBClient(dbModel, opts...)
 	if err != nil {
-		logger.Errorf("[sb] NewOVSDBClient failed: %v", err)
-		return nil, err
+		log.Error("NewOVSDBClient failed", logger.KeyErr, err)
+		return nil, nil, err
 	}
-	logger.Debugf("[sb] client constructed")
+	log.Debug("client constructed")
 
 	if err := sb.Connect(ctx); err != nil {
-		logger.Errorf("[sb] Connect failed: %v", err)
-		return nil, err
+		log.Error("connect failed", logger.KeyErr, err)
+		return nil, nil, err
 	}
-	logger.Infof("[sb] session established (elapsed=%s)", time.Since(start).Truncate(time.Millisecond))
+	log.Info("session established", "elapsed", time.Since(start).Truncate(time.Millisecond))
 
 	// sch := sb.Schema()
 	// if tbl, ok := sch.Tables["Port_Binding"]; ok {
@@ -43,11 +131,5 @@ func ConnectSouthBound(ctx context.Context, endpoint string) (client.Client, err
 	// 	}
 	// }
 
-	if _, err := sb.MonitorAll(ctx); err != nil {
-		logger.Errorf("[sb] MonitorAll failed: %v", err)
-	}
-
-	logger.Infof("[sb] MonitorAll started")
-
-	return sb, nil
+	return sb, log, nil
 }
@@ -0,0 +1,183 @@
+package sb
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ovn-kubernetes/libovsdb/client"
+	"github.com/ovn-kubernetes/libovsdb/database/inmemory"
+	"github.com/ovn-kubernetes/libovsdb/model"
+	"github.com/ovn-kubernetes/libovsdb/ovsdb"
+	"github.com/ovn-kubernetes/libovsdb/server"
+)
+
+// testSchema is the part of OVN_Southbound the agent models.
+const testSchema = `{
+  "name": "OVN_Southbound",
+  "version": "20.37.0",
+  "tables": {
+    "Port_Binding": {
+      "columns": {
+        "logical_port": {"type": "string"},
+        "type": {"type": "string"},
+        "datapath": {"type": {"key": {"type": "uuid"}}},
+        "tunnel_key": {"type": "integer"},
+        "chassis": {"type": {"key": {"type": "uuid"}, "min": 0, "max": 1}},
+        "up": {"type": {"key": {"type": "boolean"}, "min": 0, "max": 1}},
+        "options": {"type": {"key": "string", "value": "string", "min": 0, "max": "unlimited"}},
+        "external_ids": {"type": {"key": "string", "value": "string", "min": 0, "max": "unlimited"}}
+      },
+      "isRoot": true
+    },
+    "Datapath_Binding": {
+      "columns": {
+        "tunnel_key": {"type": "integer"},
+        "external_ids": {"type": {"key": "string", "value": "string", "min": 0, "max": "unlimited"}}
+      },
+      "isRoot": true
+    },
+    "Chassis": {
+      "columns": {
+        "name": {"type": "string"},
+        "hostname": {"type": "string"}
+      },
+      "isRoot": true
+    }
+  }
+}`
+
+// newTestSB serves an in-memory OVN_Southbound holding pbs and returns a
+// client connected to it with its cache in sync, and the server's endpoint.
+func newTestSB(t *testing.T, pbs ...*PortBinding) (client.Client, string) {
+	t.Helper()
+	var schema ovsdb.DatabaseSchema
+	if err := json.Unmarshal([]byte(testSchema), &schema); err != nil {
+		t.Fatal(err)
+	}
+	dbModel, err := model.NewClientDBModel("OVN_Southbound", map[string]model.Model{
+		"Port_Binding":     &PortBinding{},
+		"Datapath_Binding": &DatapathBinding{},
+		"Chassis":          &Chassis{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbMod, errs := model.NewDatabaseModel(schema, dbModel)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	lr := logr.Discard()
+	db := inmemory.NewDatabase(map[string]model.ClientDBModel{"OVN_Southbound": dbModel}, &lr)
+	srv, err := server.NewOvsdbServer(db, &lr, dbMod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(t.TempDir(), "sb.sock")
+	endpoint := "unix:" + sock
+	go func() {
+		if err := srv.Serve("unix", sock); err != nil {
+			t.Error(err)
+		}
+	}()
+	t.Cleanup(srv.Close)
+	for deadline := time.Now().Add(time.Second); !srv.Ready(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("southbound server not ready")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cli, err := ConnectSouthBound(ctx, []string{endpoint}, nil, client.WithLeaderOnly(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cli.Close)
+
+	for _, pb := range pbs {
+		ops, err := cli.Create(pb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := cli.Transact(ctx, ops...)
+		if err == nil {
+			_, err = ovsdb.CheckOperationResults(res, ops)
+		}
+		if err != nil {
+			t.Fatalf("insert %s: %v", pb.LogicalPort, err)
+		}
+		pb.UUID = res[0].UUID.GoUUID
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var got []PortBinding
+		if err := cli.List(ctx, &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) == len(pbs) {
+			return cli, endpoint
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cache has %d Port_Bindings, want %d", len(got), len(pbs))
+		}
+	}
+}
+
+func TestTablesFor(t *testing.T) {
+	cli, _ := newTestSB(t)
+	tests := []struct {
+		name        string
+		logicalPort string
+		want        ovsdb.Condition
+	}{
+		{
+			name: "chassis",
+			want: ovsdb.Condition{
+				Column:   "options",
+				Function: ovsdb.ConditionIncludes,
+				Value:    ovsdb.OvsMap{GoMap: map[any]any{"requested-chassis": "hv1"}},
+			},
+		},
+		{
+			name:        "port",
+			logicalPort: "p2",
+			want:        ovsdb.Condition{Column: "logical_port", Function: ovsdb.ConditionEqual, Value: "p2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := cli.NewMonitor(tablesFor("hv1", tt.logicalPort)...)
+			if len(m.Errors) > 0 {
+				t.Fatal(m.Errors)
+			}
+			got := make(map[string][]ovsdb.Condition)
+			for _, tm := range m.Tables {
+				got[tm.Table] = tm.Conditions
+			}
+			want := map[string][]ovsdb.Condition{
+				"Port_Binding": {tt.want},
+				"Chassis":      nil,
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("monitored %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestConnectSouthBoundFor(t *testing.T) {
+	_, endpoint := newTestSB(t, &PortBinding{LogicalPort: "p1", Datapath: "5d8a37a4-2f3c-4c1e-9a64-0b8f1c2d3e4f"})
+	ctx := context.Background()
+	cli, err := ConnectSouthBoundFor(ctx, []string{endpoint}, "hv1", "p1", client.WithLeaderOnly(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if pb, err := FindBinding(ctx, cli, "p1"); err != nil || pb.LogicalPort != "p1" {
+		t.Errorf("FindBinding = %+v, %v after the initial dump", pb, err)
+	}
+}
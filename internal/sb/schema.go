@@ -9,5 +9,18 @@ type PortBinding struct {
 	Chassis     *string `ovsdb:"chassis"`
 	Up          *bool   `ovsdb:"up"`
 
-	Options map[string]string `ovsdb:"options"`
+	Options     map[string]string `ovsdb:"options"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+}
+
+type DatapathBinding struct {
+	UUID        string            `ovsdb:"_uuid"`
+	TunnelKey   int               `ovsdb:"tunnel_key"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+}
+
+type Chassis struct {
+	UUID     string `ovsdb:"_uuid"`
+	Name     string `ovsdb:"name"`
+	Hostname string `ovsdb:"hostname"`
 }
@@ -0,0 +1,279 @@
+package sb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ovn-kubernetes/libovsdb/client"
+	"github.com/ovn-kubernetes/libovsdb/model"
+	"github.com/ovn-kubernetes/libovsdb/ovsdb"
+	"github.com/yangjie500/cloud-ovs-agent/internal/audit"
+	"github.com/yangjie500/cloud-ovs-agent/internal/metrics"
+	"github.com/yangjie500/cloud-ovs-agent/internal/tracing"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+)
+
+// Port_Binding external_ids keys owned by the agent.
+const (
+	StatusKey        = "cloud-ovs-agent:status"
+	StatusReasonKey  = "cloud-ovs-agent:reason"
+	StatusTimeKey    = "cloud-ovs-agent:timestamp"
+	StatusChassisKey = "cloud-ovs-agent:chassis"
+)
+
+var statusKeys = []string{StatusKey, StatusReasonKey, StatusTimeKey, StatusChassisKey}
+
+type PortState string
+
+const (
+	StatePlugging  PortState = "plugging"
+	StatePlugged   PortState = "plugged"
+	StateFailed    PortState = "failed"
+	StateUnplugged PortState = "unplugged"
+)
+
+const (
+	maxReasonLen     = 256
+	maxStatusesPerTx = 256
+)
+
+// errStatusDenied is returned by write when the SB's RBAC rules do not let
+// this chassis modify Port_Binding external_ids.
+var errStatusDenied = errors.New("permission denied")
+
+type statusUpdate struct {
+	logicalPort string
+	state       PortState // empty = remove the agent's keys
+	reason      string
+	at          time.Time
+}
+
+// StatusPublisher writes per-port status into Port_Binding external_ids. All
+// pending updates go out in one transaction at most once per interval, and
+// only the latest state of each port is written. A nil *StatusPublisher
+// publishes nothing.
+//
+// If the SB refuses a write for lack of permission, e.g. under OVN's RBAC
+// for the ovn-controller role, publishing stops for good: retrying cannot
+// succeed until the SB's rules change.
+type StatusPublisher struct {
+	Chassis  string
+	Interval time.Duration
+
+	mu       sync.Mutex
+	pending  map[string]statusUpdate // by Port_Binding UUID
+	disabled bool
+	wake     chan struct{}
+}
+
+func NewStatusPublisher(chassis string, interval time.Duration) *StatusPublisher {
+	return &StatusPublisher{
+		Chassis:  chassis,
+		Interval: interval,
+		pending:  make(map[string]statusUpdate),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Set records pb's state; err, if any, becomes the reason.
+func (p *StatusPublisher) Set(pb *PortBinding, state PortState, err error) {
+	if p == nil {
+		return
+	}
+	u := statusUpdate{logicalPort: pb.LogicalPort, state: state, at: time.Now()}
+	if err != nil {
+		u.reason = err.Error()
+		if len(u.reason) > maxReasonLen {
+			u.reason = u.reason[:maxReasonLen]
+		}
+	}
+	p.queue(pb.UUID, u)
+}
+
+// Clear removes the agent's keys from pb, e.g. when the port is bound away
+// from this chassis.
+func (p *StatusPublisher) Clear(pb *PortBinding) {
+	if p == nil {
+		return
+	}
+	p.queue(pb.UUID, statusUpdate{logicalPort: pb.LogicalPort})
+}
+
+// Forget drops anything pending for a deleted Port_Binding.
+func (p *StatusPublisher) Forget(uuid string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	delete(p.pending, uuid)
+	p.mu.Unlock()
+}
+
+func (p *StatusPublisher) queue(uuid string, u statusUpdate) {
+	p.mu.Lock()
+	if p.disabled {
+		p.mu.Unlock()
+		return
+	}
+	p.pending[uuid] = u
+	p.mu.Unlock()
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run writes pending updates through cli until ctx is done. Updates queued
+// before Run starts are kept.
+func (p *StatusPublisher) Run(ctx context.Context, cli client.Client) {
+	if p == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wake:
+		}
+
+		if !p.flush(ctx, cli) {
+			return
+		}
+
+		// Let updates pile up until the next write is allowed.
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.Interval):
+		}
+	}
+}
+
+// flush writes up to maxStatusesPerTx pending updates. It returns false once
+// publishing has been disabled.
+func (p *StatusPublisher) flush(ctx context.Context, cli client.Client) bool {
+	p.mu.Lock()
+	batch := make(map[string]statusUpdate, min(len(p.pending), maxStatusesPerTx))
+	for uuid, u := range p.pending {
+		if len(batch) == maxStatusesPerTx {
+			break
+		}
+		batch[uuid] = u
+		delete(p.pending, uuid)
+	}
+	more := len(p.pending) > 0
+	p.mu.Unlock()
+
+	if len(batch) > 0 {
+		err := p.write(ctx, cli, batch)
+		if errors.Is(err, errStatusDenied) {
+			log.Error("the Southbound DB does not allow this chassis to write Port_Binding external_ids; port status publishing is disabled",
+				logger.KeyErr, err)
+			p.disable()
+			return false
+		}
+		if err != nil {
+			log.Warn("publishing port status failed; will retry", "ports", len(batch), logger.KeyErr, err)
+			p.requeue(batch)
+			more = true
+		}
+	}
+	if more {
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// disable stops publishing and drops what is pending.
+func (p *StatusPublisher) disable() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.disabled = true
+	clear(p.pending)
+}
+
+// requeue puts back failed updates unless a newer one arrived meanwhile.
+func (p *StatusPublisher) requeue(batch map[string]statusUpdate) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for uuid, u := range batch {
+		if _, newer := p.pending[uuid]; !newer {
+			p.pending[uuid] = u
+		}
+	}
+}
+
+func (p *StatusPublisher) write(ctx context.Context, cli client.Client, batch map[string]statusUpdate) (err error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "sb.publish_status", tracing.Ops.Int(len(batch)))
+	defer func() {
+		metrics.ObserveOp(metrics.OpPublishStatus, start, err)
+		tracing.End(span, err)
+	}()
+
+	ops := make([]ovsdb.Operation, 0, len(batch))
+	for uuid, u := range batch {
+		pb := &PortBinding{UUID: uuid}
+		muts := []model.Mutation{{Field: &pb.ExternalIDs, Mutator: ovsdb.MutateOperationDelete, Value: statusKeys}}
+		if u.state != "" {
+			ids := map[string]string{
+				StatusKey:        string(u.state),
+				StatusTimeKey:    u.at.UTC().Format(time.RFC3339),
+				StatusChassisKey: p.Chassis,
+			}
+			if u.reason != "" {
+				ids[StatusReasonKey] = u.reason
+			}
+			muts = append(muts, model.Mutation{Field: &pb.ExternalIDs, Mutator: ovsdb.MutateOperationInsert, Value: ids})
+		}
+		op, err := cli.Where(pb).Mutate(pb, muts...)
+		if err != nil {
+			return fmt.Errorf("build status mutation for %s: %w", u.logicalPort, err)
+		}
+		ops = append(ops, op...)
+	}
+
+	res, err := cli.Transact(ctx, ops...)
+	if err == nil {
+		_, err = ovsdb.CheckOperationResults(res, ops)
+	}
+	if denied := permissionError(res); denied != "" {
+		err = fmt.Errorf("%w: %s", errStatusDenied, denied)
+	}
+	if audit.Enabled() {
+		ports := make([]string, 0, len(batch))
+		for _, u := range batch {
+			ports = append(ports, u.logicalPort)
+		}
+		audit.Record(ctx, audit.SBWrite, "OVN_Southbound", start, err, map[string]any{
+			"ports":       ports,
+			"transaction": audit.Transaction{Ops: ops, Result: res},
+		})
+	}
+	if err != nil {
+		return err
+	}
+	log.Debug("published port status", "ports", len(batch), "elapsed", time.Since(start).Truncate(time.Millisecond))
+	return nil
+}
+
+// permissionError returns the details of the first "permission error" in res,
+// which ovsdb-server reports when RBAC rules forbid an operation.
+func permissionError(res []ovsdb.OperationResult) string {
+	for _, r := range res {
+		if r.Error == "permission error" {
+			if r.Details == "" {
+				return r.Error
+			}
+			return r.Details
+		}
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package sb
+
+import (
+	"testing"
+
+	"github.com/ovn-kubernetes/libovsdb/ovsdb"
+)
+
+func TestPermissionError(t *testing.T) {
+	rbac := `RBAC rules for client "hv1" role "ovn-controller" prohibit modification of table "Port_Binding".`
+	tests := []struct {
+		name string
+		res  []ovsdb.OperationResult
+		want string
+	}{
+		{name: "success", res: []ovsdb.OperationResult{{Count: 1}, {Count: 1}}},
+		{name: "no results"},
+		{
+			name: "other error",
+			res:  []ovsdb.OperationResult{{Error: "constraint violation", Details: "bad"}},
+		},
+		{
+			name: "rbac refusal",
+			res:  []ovsdb.OperationResult{{Count: 1}, {Error: "permission error", Details: rbac}},
+			want: rbac,
+		},
+		{
+			name: "refusal without details",
+			res:  []ovsdb.OperationResult{{Error: "permission error"}},
+			want: "permission error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := permissionError(tt.res); got != tt.want {
+				t.Errorf("permissionError() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusPublisherDisabled(t *testing.T) {
+	p := NewStatusPublisher("hv1", 0)
+	pb := &PortBinding{UUID: "pb1", LogicalPort: "p1"}
+	p.Set(pb, StatePlugging, nil)
+
+	p.disable()
+	p.Set(pb, StatePlugged, nil)
+	p.Clear(pb)
+
+	if len(p.pending) != 0 {
+		t.Errorf("%d updates pending after disable", len(p.pending))
+	}
+}
@@ -0,0 +1,91 @@
+package sb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+)
+
+// TLSFiles names the PEM files used for ssl: connections, like ovn-controller's
+// --private-key, --certificate and --ca-cert.
+type TLSFiles struct {
+	PrivateKey  string
+	Certificate string
+	CACert      string
+	ServerName  string // optional; when empty the server certificate is checked against the CA only, as OVS does
+}
+
+// NewTLSConfig builds a client TLS config that re-reads the key pair and CA on
+// every handshake, so certificates rotated on disk are used from the next
+// reconnect without restarting the agent.
+func NewTLSConfig(f TLSFiles) (*tls.Config, error) {
+	// Fail at startup rather than on the first handshake.
+	if _, err := tls.LoadX509KeyPair(f.Certificate, f.PrivateKey); err != nil {
+		return nil, fmt.Errorf("load client certificate: %w", err)
+	}
+	if _, err := loadCAPool(f.CACert); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: f.ServerName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(f.Certificate, f.PrivateKey)
+			if err != nil {
+				log.Error("reload client certificate failed", logger.KeyErr, err)
+				return nil, err
+			}
+			log.Debug("presenting client certificate", "file", f.Certificate)
+			return &cert, nil
+		},
+		// The default verifier only knows a CA pool fixed at construction time;
+		// verify against the current CA file ourselves instead.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return verifyPeer(cs, f)
+		},
+	}, nil
+}
+
+func loadCAPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+func verifyPeer(cs tls.ConnectionState, f TLSFiles) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	roots, err := loadCAPool(f.CACert)
+	if err != nil {
+		log.Error("reload CA certificate failed", logger.KeyErr, err)
+		return err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err = cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       f.ServerName,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("verify server certificate: %w", err)
+	}
+	return nil
+}
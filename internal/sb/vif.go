@@ -0,0 +1,93 @@
+package sb
+
+import (
+	"fmt"
+
+	"github.com/yangjie500/cloud-ovs-agent/internal/netdev"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+)
+
+// Port_Binding options that select the device backing a port. Ports without
+// vif-kind get a TAP on the integration bridge.
+const (
+	optVifKind   = "vif-kind"   // tap | macvtap | ipvlan
+	optVifParent = "vif-parent" // uplink device for macvtap/ipvlan
+	optVifMode   = "vif-mode"   // macvtap: bridge|passthru|vepa, ipvlan: l2|l3|l3s
+
+	optNetdevProfile = "netdev-profile" // overrides the network's profile
+)
+
+// Policy holds the per-port settings that may change while the agent runs.
+type Policy struct {
+	MTU             int
+	Profiles        map[string]*netdev.Profile
+	NetworkProfiles map[string]string // datapath UUID or logical switch name -> profile name
+}
+
+func vifKind(pb *PortBinding) (netdev.Kind, error) {
+	return netdev.ParseKind(pb.Options[optVifKind])
+}
+
+func (w *PBWatcher) vifSpecFor(pb *PortBinding) (netdev.VifSpec, error) {
+	kind, err := vifKind(pb)
+	if err != nil {
+		return netdev.VifSpec{}, err
+	}
+
+	p := w.policy()
+	profile, err := w.profileFor(p, pb)
+	if err != nil {
+		return netdev.VifSpec{}, err
+	}
+
+	return netdev.VifSpec{
+		Kind:    kind,
+		MTU:     p.MTU,
+		VnetHdr: kind == netdev.KindTap,
+		Parent:  pb.Options[optVifParent],
+		Mode:    pb.Options[optVifMode],
+		Profile: profile,
+	}, nil
+}
+
+// profileFor picks the port's device profile: the port's own netdev-profile
+// option first, then the profile configured for its network.
+func (w *PBWatcher) profileFor(p *Policy, pb *PortBinding) (*netdev.Profile, error) {
+	name := pb.Options[optNetdevProfile]
+	if name == "" {
+		name = w.networkProfile(p, pb.Datapath)
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	profile, ok := p.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown netdev profile %q", name)
+	}
+	return profile, nil
+}
+
+func (w *PBWatcher) networkProfile(p *Policy, datapath string) string {
+	if len(p.NetworkProfiles) == 0 || datapath == "" {
+		return ""
+	}
+	if name, ok := p.NetworkProfiles[datapath]; ok {
+		return name
+	}
+
+	dp := &DatapathBinding{UUID: datapath}
+	if err := w.SbCli.Get(w.Ctx, dp); err != nil {
+		log.Debug("datapath not in cache", logger.KeyDatapath, datapath, logger.KeyErr, err)
+		return ""
+	}
+	// northd records the logical switch name and NB UUID on the datapath.
+	for _, key := range []string{"name", "logical-switch"} {
+		if v := dp.ExternalIDs[key]; v != "" {
+			if name, ok := p.NetworkProfiles[v]; ok {
+				return name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+// Package tracing exports OpenTelemetry spans of the port pipelines (SB event,
+// TAP creation, OVS transaction, link up) to an OTLP collector. Until Init is
+// called with an endpoint, every span is a no-op.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yangjie500/cloud-ovs-agent/pkg/config"
+	"github.com/yangjie500/cloud-ovs-agent/pkg/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "cloud-ovs-agent"
+
+var log = logger.Named("agent")
+
+// Span attribute keys.
+const (
+	LogicalPort = attribute.Key("ovn.logical_port")
+	Datapath    = attribute.Key("ovn.datapath")
+	Chassis     = attribute.Key("ovn.chassis")
+	Bridge      = attribute.Key("ovs.bridge")
+	Ops         = attribute.Key("ovsdb.ops")
+	IfName      = attribute.Key("net.ifname")
+	VifKind     = attribute.Key("vif.kind")
+	Skipped     = attribute.Key("agent.skipped") // why an event was not acted on
+)
+
+// The global provider is a no-op until Init replaces it; tracers obtained
+// earlier pick up the replacement.
+var tracer = otel.Tracer("github.com/yangjie500/cloud-ovs-agent")
+
+// Init installs an OTLP exporter as described by cfg. With no endpoint set it
+// does nothing. The returned function flushes pending spans and stops the
+// exporter.
+func Init(ctx context.Context, cfg config.TracingConfig, chassis string) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var (
+		exp sdktrace.SpanExporter
+		err error
+	)
+	switch cfg.Protocol {
+	case "http":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exp, err = otlptracehttp.New(ctx, opts...)
+	default:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exp, err = otlptracegrpc.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("otlp exporter: %w", err)
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.HostName(chassis),
+		Chassis.String(chassis),
+	)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Warn("trace export failed", logger.KeyErr, err)
+	}))
+
+	log.Info("tracing enabled", "endpoint", cfg.Endpoint, "protocol", cfg.Protocol, "sample_ratio", cfg.SampleRatio)
+	return tp.Shutdown, nil
+}
+
+// Start opens a span as a child of any span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End marks span failed if err is set, then ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,220 @@
+package adminapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Errors matched by an *Error.
+var (
+	ErrNotFound = errors.New("not found")         // a port the agent does not know
+	ErrConflict = errors.New("conflict")          // a port the SB binding does not let the agent plug or unplug
+	ErrTimeout  = errors.New("timed out waiting") // a waited-for plug or unplug that is still running
+)
+
+// ErrStreamEnded is returned by Watch when the agent ends the stream.
+var ErrStreamEnded = errors.New("event stream ended")
+
+// Error is a non-2xx reply from the agent.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("admin API: %s (HTTP %d)", e.Message, e.Status)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound
+	case ErrConflict:
+		return e.Status == http.StatusConflict
+	case ErrTimeout:
+		return e.Status == http.StatusGatewayTimeout
+	}
+	return false
+}
+
+// Client talks to the admin API on the agent's unix socket.
+type Client struct {
+	hc *http.Client
+}
+
+// New returns a client for the agent listening on socket. Connections are
+// made lazily.
+func New(socket string) *Client {
+	tr := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &Client{hc: &http.Client{Transport: tr}}
+}
+
+// Ports lists the managed ports.
+func (c *Client) Ports(ctx context.Context) ([]Port, error) {
+	var out []Port
+	return out, c.do(ctx, http.MethodGet, "/v1/ports", nil, &out)
+}
+
+// Port returns one managed port; it fails with ErrNotFound if the agent does
+// not manage logicalPort.
+func (c *Client) Port(ctx context.Context, logicalPort string) (PortDetail, error) {
+	var out PortDetail
+	return out, c.do(ctx, http.MethodGet, "/v1/ports/"+url.PathEscape(logicalPort), nil, &out)
+}
+
+// Events returns up to limit of the latest port events; limit <= 0 returns
+// all the agent keeps.
+func (c *Client) Events(ctx context.Context, limit int) ([]Event, error) {
+	path := "/v1/events"
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+	var out []Event
+	return out, c.do(ctx, http.MethodGet, path, nil, &out)
+}
+
+// Bindings lists every binding requested on the agent's chassis.
+func (c *Client) Bindings(ctx context.Context) ([]Binding, error) {
+	var out []Binding
+	return out, c.do(ctx, http.MethodGet, "/v1/bindings", nil, &out)
+}
+
+// Explain says why logicalPort is or is not plugged.
+func (c *Client) Explain(ctx context.Context, logicalPort string) (Explanation, error) {
+	var out Explanation
+	return out, c.do(ctx, http.MethodGet, "/v1/ports/"+url.PathEscape(logicalPort)+"/explain", nil, &out)
+}
+
+// Reconcile queues a reconcile of logicalPort, or of every port if
+// logicalPort is empty.
+func (c *Client) Reconcile(ctx context.Context, logicalPort string) (Reconciled, error) {
+	path := "/v1/reconcile"
+	if logicalPort != "" {
+		path = "/v1/ports/" + url.PathEscape(logicalPort) + "/reconcile"
+	}
+	var out Reconciled
+	return out, c.do(ctx, http.MethodPost, path, nil, &out)
+}
+
+// Plug asks the agent to plug logicalPort. With req.Wait set it returns once
+// the plug has run, failing with ErrTimeout if that takes longer than
+// req.Timeout; a failed plug is reported in the result's State and Error.
+func (c *Client) Plug(ctx context.Context, logicalPort string, req PlugRequest) (PortResult, error) {
+	var out PortResult
+	return out, c.do(ctx, http.MethodPost, "/v1/ports/"+url.PathEscape(logicalPort)+"/plug", req, &out)
+}
+
+// Unplug asks the agent to unplug logicalPort, like Plug.
+func (c *Client) Unplug(ctx context.Context, logicalPort string, req UnplugRequest) (PortResult, error) {
+	var out PortResult
+	return out, c.do(ctx, http.MethodPost, "/v1/ports/"+url.PathEscape(logicalPort)+"/unplug", req, &out)
+}
+
+// WatchOptions filter the events Watch delivers. Empty filters match every
+// port.
+type WatchOptions struct {
+	Ports     []string // logical ports
+	Datapaths []string
+	Since     *uint64 // replay the kept events after this Seq first; nil = new events only
+}
+
+// Watch passes port events to fn as they happen until ctx is done, fn returns
+// an error, or the agent ends the stream, which it does when the agent shuts
+// down or the client falls too far behind. To carry on without a gap, watch
+// again with Since set to the last Seq seen; an EventsLost event first says if
+// that is no longer possible.
+func (c *Client) Watch(ctx context.Context, opts WatchOptions, fn func(Event) error) error {
+	q := url.Values{"format": {"ndjson"}}
+	for _, p := range opts.Ports {
+		q.Add("port", p)
+	}
+	for _, d := range opts.Datapaths {
+		q.Add("datapath", d)
+	}
+	if opts.Since != nil {
+		q.Set("since", strconv.FormatUint(*opts.Since, 10))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://agent/v1/events/stream?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return replyError(resp)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev Event
+		if err := dec.Decode(&ev); err != nil {
+			switch {
+			case ctx.Err() != nil:
+				return ctx.Err()
+			case errors.Is(err, io.EOF):
+				return ErrStreamEnded
+			}
+			return fmt.Errorf("read event stream: %w", err)
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encode %s request: %w", path, err)
+		}
+		body = bytes.NewReader(raw)
+	}
+	// The host is ignored; the transport always dials the socket.
+	req, err := http.NewRequestWithContext(ctx, method, "http://agent"+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return replyError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s reply: %w", path, err)
+	}
+	return nil
+}
+
+func replyError(resp *http.Response) error {
+	var body errorBody
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(raw, &body) != nil || body.Error == "" {
+		body.Error = http.StatusText(resp.StatusCode)
+	}
+	return &Error{Status: resp.StatusCode, Message: body.Error}
+}
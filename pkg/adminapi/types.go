@@ -0,0 +1,183 @@
+// Package adminapi is the agent's local admin API: the JSON types it serves
+// over a unix socket and a client for them.
+//
+//	GET  /v1/ports                    managed ports
+//	GET  /v1/ports/{logical_port}     one port, with its last error and history
+//	GET  /v1/events?limit=N           recent port events, oldest first
+//	GET  /v1/events/stream            port events as they happen, see Watch
+//	GET  /v1/bindings                 every binding requested on this chassis
+//	GET  /v1/ports/{logical_port}/explain
+//	POST /v1/reconcile                reconcile every port bound to this chassis
+//	POST /v1/ports/{logical_port}/reconcile
+//	POST /v1/ports/{logical_port}/plug      PlugRequest -> PortResult
+//	POST /v1/ports/{logical_port}/unplug    UnplugRequest -> PortResult
+//
+// Errors are returned as {"error": "..."} with a 4xx or 5xx status.
+package adminapi
+
+import "time"
+
+// Link states reported in Port.Link.
+const (
+	LinkUp      = "up"
+	LinkDown    = "down"
+	LinkMissing = "missing"
+	LinkUnknown = "unknown"
+)
+
+// Port is a managed port as the agent, OVS, the kernel and the Southbound DB
+// see it.
+type Port struct {
+	LogicalPort string    `json:"logical_port"`
+	IfName      string    `json:"ifname"`
+	Datapath    string    `json:"datapath,omitempty"`
+	PortBinding string    `json:"port_binding"` // Port_Binding UUID
+	State       string    `json:"state"`        // plugging, plugged or failed
+	Since       time.Time `json:"since"`
+
+	OVSPort string `json:"ovs_port,omitempty"` // Port UUID
+	Bridge  string `json:"bridge,omitempty"`
+	OFPort  *int   `json:"ofport,omitempty"`
+
+	Link      string `json:"link"` // admin state: up, down, missing or unknown
+	OperState string `json:"oper_state,omitempty"`
+	MAC       string `json:"mac,omitempty"`
+
+	SBChassis string `json:"sb_chassis,omitempty"` // chassis that claimed the port
+	SBUp      *bool  `json:"sb_up,omitempty"`
+}
+
+type PortDetail struct {
+	Port
+	LastError string  `json:"last_error,omitempty"`
+	History   []Event `json:"history"` // oldest first
+}
+
+// Event types.
+const (
+	EventBindingSeen  = "binding_seen"
+	EventPlugStarted  = "plug_started"
+	EventTapCreated   = "tap_created"
+	EventOVSAttached  = "ovs_attached"
+	EventLinkUp       = "link_up"
+	EventPlugged      = "plugged"
+	EventOVNInstalled = "ovn_installed"
+	EventFailed       = "failed"
+	EventUnplugged    = "unplugged"
+	EventLinkChanged  = "link_changed"  // the device changed outside the agent; Detail says how
+	EventLinkRepaired = "link_repaired" // the same, and the agent changed it back
+
+	// EventsLost starts a stream resumed from a sequence number whose
+	// following events the agent no longer has, e.g. after a restart. Its
+	// Seq is that of the last event lost.
+	EventsLost = "events_lost"
+)
+
+type Event struct {
+	Seq         uint64    `json:"seq"`
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	LogicalPort string    `json:"logical_port"`
+	Datapath    string    `json:"datapath,omitempty"`
+	Trigger     string    `json:"trigger,omitempty"` // add, update, delete, reconcile, link
+	Detail      string    `json:"detail,omitempty"`  // for link events
+	Error       string    `json:"error,omitempty"`
+}
+
+// Reconciled lists the ports a reconcile queued work for. The work runs in
+// the background; follow it through Events or Port.
+type Reconciled struct {
+	Plug   []string `json:"plug"`
+	Unplug []string `json:"unplug"`
+}
+
+// OVS attachment states reported in Binding.OVS.
+const (
+	OVSAttached     = "attached"
+	OVSMissing      = "missing"        // no Interface, or not in a Port
+	OVSWrongBridge  = "wrong-bridge"   // on a bridge other than the agent's
+	OVSWrongIfaceID = "wrong-iface-id" // external_ids:iface-id is not the logical port
+	OVSError        = "error"          // ovs-vswitchd reported an Interface error
+	OVSBypassed     = "n/a"            // the device kind does not use OVS
+)
+
+// Binding is a Port_Binding requested on this chassis and what the host has
+// for it.
+type Binding struct {
+	LogicalPort string `json:"logical_port"`
+	Datapath    string `json:"datapath,omitempty"`
+	IfName      string `json:"ifname"`
+	Kind        string `json:"kind"`
+	State       string `json:"state,omitempty"` // agent's port state; empty if it has not handled the port
+
+	Link   string `json:"link"` // up, down, missing or unknown
+	OVS    string `json:"ovs"`
+	OFPort *int   `json:"ofport,omitempty"`
+
+	SBChassis string `json:"sb_chassis,omitempty"`
+	SBUp      *bool  `json:"sb_up,omitempty"`
+}
+
+// Check results.
+const (
+	CheckOK   = "ok"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+)
+
+// Check is one step of an explanation.
+type Check struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Detail string `json:"detail"`
+}
+
+// Explanation walks the decisions behind a port being plugged or not, in the
+// order the agent makes them.
+type Explanation struct {
+	LogicalPort string  `json:"logical_port"`
+	Plugged     bool    `json:"plugged"`
+	Summary     string  `json:"summary"`
+	Checks      []Check `json:"checks"`
+	Source      string  `json:"source"` // "agent" or "direct"
+}
+
+// PlugRequest asks the agent to plug a port. Unless the agent is standalone,
+// the port must have a Port_Binding requested on this chassis, and Datapath
+// and Options, which stand in for that binding, are refused.
+type PlugRequest struct {
+	Wait    bool   `json:"wait,omitempty"`    // reply once the plug has run
+	Timeout string `json:"timeout,omitempty"` // Go duration bounding Wait; default 30s
+
+	Datapath string            `json:"datapath,omitempty"`
+	Options  map[string]string `json:"options,omitempty"` // Port_Binding options, e.g. vif-kind
+}
+
+// UnplugRequest asks the agent to unplug a port. Unless the agent is
+// standalone, the port must no longer be requested on this chassis.
+type UnplugRequest struct {
+	Wait    bool   `json:"wait,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Port states reported in PortResult.State.
+const (
+	StateQueued    = "queued" // the request did not wait
+	StatePlugged   = "plugged"
+	StateUnplugged = "unplugged"
+	StateFailed    = "failed"
+)
+
+// PortResult is the outcome of a plug or unplug request. A request that
+// waited and failed still gets a PortResult, with State failed and Error set.
+type PortResult struct {
+	LogicalPort string `json:"logical_port"`
+	IfName      string `json:"ifname"`
+	MAC         string `json:"mac,omitempty"`
+	State       string `json:"state"`
+	Error       string `json:"error,omitempty"`
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
@@ -1,107 +1,316 @@
 package config
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
-type Config struct {
-	LogLevel string
-
-	LogFile       string
-	LogToStdout   bool
-	LogMaxSizeMb  int
-	LogMaxBackups int
-	LogMaxAgeDays int
-	LogCompress   bool
-
-	SouthboundIp   string
-	SouthboundPort string
-	HypervisorName string
-}
-
-func LoadAll(dotenvPaths ...string) (Config, error) {
-	// Load first .env found (if exists). Safe to call with no args, it tries ".env" by default.
-	if len(dotenvPaths) > 0 {
-		_ = godotenv.Load(dotenvPaths...)
-	} else {
-		_ = godotenv.Load()
+type LoggingConfig struct {
+	Level          string            `yaml:"level" validate:"oneof=trace debug info warn error"`
+	Format         string            `yaml:"format" validate:"oneof=text json"`
+	Levels         map[string]string `yaml:"levels" validate:"dive,keys,oneof=ovs sb netdev agent config,endkeys,oneof=trace debug info warn error"` // subsystem -> level
+	Sinks          []string          `yaml:"sinks" validate:"dive,oneof=file stdout journald syslog"`                                                // empty = file, plus stdout if to_stdout
+	File           string            `yaml:"file" validate:"required"`
+	ToStdout       bool              `yaml:"to_stdout"`
+	MaxSizeMb      int               `yaml:"max_size_mb" validate:"gt=0"`
+	MaxBackups     int               `yaml:"max_backups" validate:"gte=0"`
+	MaxAgeDays     int               `yaml:"max_age_days" validate:"gte=0"`
+	Compress       bool              `yaml:"compress"`
+	Tag            string            `yaml:"tag" validate:"required"` // SYSLOG_IDENTIFIER / syslog tag
+	SyslogFacility string            `yaml:"syslog_facility" validate:"oneof=daemon user local0 local1 local2 local3 local4 local5 local6 local7"`
+}
+
+// SinkNames returns the configured sinks, resolving the legacy file/to_stdout
+// settings when sinks is not set.
+func (l LoggingConfig) SinkNames() []string {
+	if len(l.Sinks) > 0 {
+		return l.Sinks
+	}
+	if l.ToStdout {
+		return []string{"stdout", "file"}
 	}
+	return []string{"file"}
+}
 
-	return Load()
+// AuditConfig controls the JSONL audit log of the agent's dataplane changes,
+// rotated separately from the debug log.
+type AuditConfig struct {
+	File       string `yaml:"file"` // empty = disabled
+	MaxSizeMb  int    `yaml:"max_size_mb" validate:"gt=0"`
+	MaxBackups int    `yaml:"max_backups" validate:"gte=0"`
+	MaxAgeDays int    `yaml:"max_age_days" validate:"gte=0"`
+	Compress   bool   `yaml:"compress"`
 }
 
-func Load() (Config, error) {
-	var cfg Config
-	var errs []string
+// TLSConfig names the PEM files for ssl: connections. Setting any of the key,
+// certificate or CA requires all three.
+type TLSConfig struct {
+	PrivateKey  string `yaml:"private_key" validate:"required_with=Certificate CACert,omitempty,file"`
+	Certificate string `yaml:"certificate" validate:"required_with=PrivateKey CACert,omitempty,file"`
+	CACert      string `yaml:"ca_cert" validate:"required_with=PrivateKey Certificate,omitempty,file"`
+	ServerName  string `yaml:"server_name" validate:"omitempty,hostname_rfc1123"`
+}
+
+func (t TLSConfig) Enabled() bool {
+	return t.PrivateKey != "" || t.Certificate != "" || t.CACert != ""
+}
 
-	cfg.LogLevel = getenv("LOG_LEVEL", "info")
-	cfg.LogFile = getenv("LOG_FILE", "./logs/app.log")
-	cfg.LogToStdout = mustBool("LOG_TO_STDOUT", true, &errs)
-	cfg.LogMaxSizeMb = mustInt("LOG_MAX_SIZE_MB", 100, &errs)
-	cfg.LogMaxBackups = mustInt("LOG_MAX_BACKUPS", 7, &errs)
-	cfg.LogMaxAgeDays = mustInt("LOG_MAX_AGE_DAYS", 14, &errs)
-	cfg.LogCompress = mustBool("LOG_COMPRESS", true, &errs)
-	cfg.SouthboundIp = getenv("SOUTHBOUND_IP", "")
-	cfg.SouthboundPort = getenv("SOUTHBOUND_PORT", "6642")
-	cfg.HypervisorName = getenv("HYPERVISOR_NAME", "hypervisor-1")
+type SouthboundConfig struct {
+	Remote     string    `yaml:"remote"`      // comma-separated OVSDB remotes, see ParseRemote; required unless agent.standalone
+	LeaderOnly bool      `yaml:"leader_only"` // only use the Raft leader of a clustered SB
+	TLS        TLSConfig `yaml:"tls"`
+}
 
-	if len(errs) > 0 {
-		return cfg, errors.New(strings.Join(errs, "; "))
-	}
+const (
+	defaultSouthboundPort = 6642
+	defaultOVSPort        = 6640
+)
 
-	return cfg, nil
+func (s SouthboundConfig) Endpoints() ([]Endpoint, error) {
+	return ParseRemote(s.Remote, defaultSouthboundPort)
+}
 
+type OVSConfig struct {
+	Endpoint string `yaml:"endpoint"` // empty = auto-detect the local db.sock
+	Bridge   string `yaml:"bridge" validate:"required"`
 }
 
-func getenv(key, def string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+type HTTPConfig struct {
+	Listen string `yaml:"listen"` // host:port for /metrics; empty = disabled
+}
+
+// AdminConfig places the local admin API's unix socket.
+type AdminConfig struct {
+	Socket string `yaml:"socket"` // empty = disabled
+	Group  string `yaml:"group"`  // group also allowed to use the socket; empty = agent's user only
+}
+
+// TracingConfig exports OpenTelemetry spans of the port pipelines over OTLP.
+type TracingConfig struct {
+	Endpoint    string  `yaml:"endpoint" validate:"omitempty,hostname_port"` // collector host:port; empty = tracing off
+	Protocol    string  `yaml:"protocol" validate:"oneof=grpc http"`
+	Insecure    bool    `yaml:"insecure"` // plaintext, e.g. to a collector on localhost
+	SampleRatio float64 `yaml:"sample_ratio" validate:"gte=0,lte=1"`
+}
+
+type NetdevProfile struct {
+	TxQueueLen int             `yaml:"txqueuelen" validate:"gte=0"`
+	Alias      string          `yaml:"alias"`
+	Offloads   map[string]bool `yaml:"offloads" validate:"dive,keys,oneof=rx tx sg tso gso gro lro,endkeys"`
+}
+
+type NetdevConfig struct {
+	MTU               int                      `yaml:"mtu" validate:"min=68,max=65535"`
+	Repair            bool                     `yaml:"repair"`
+	Netns             string                   `yaml:"netns"`
+	ReconcileInterval time.Duration            `yaml:"reconcile_interval" validate:"gt=0"`
+	Profiles          map[string]NetdevProfile `yaml:"profiles" validate:"dive"`
+	NetworkProfiles   map[string]string        `yaml:"network_profiles"` // datapath UUID or logical switch name -> profile
+}
+
+type AgentConfig struct {
+	Chassis string `yaml:"chassis" validate:"required,hostname_rfc1123"` // this host's chassis name (HYPERVISOR_NAME)
+	Workers int    `yaml:"workers" validate:"min=1,max=256"`             // port operations run concurrently
+
+	Status         bool          `yaml:"status"`                          // publish per-port status to Port_Binding external_ids
+	StatusInterval time.Duration `yaml:"status_interval" validate:"gt=0"` // minimum time between status writes
+
+	Standalone bool `yaml:"standalone"` // no Southbound DB; ports are plugged through the admin API only
+}
+
+type Config struct {
+	Logging    LoggingConfig    `yaml:"logging"`
+	Audit      AuditConfig      `yaml:"audit"`
+	Southbound SouthboundConfig `yaml:"southbound"`
+	OVS        OVSConfig        `yaml:"ovs"`
+	HTTP       HTTPConfig       `yaml:"http"`
+	Admin      AdminConfig      `yaml:"admin"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Netdev     NetdevConfig     `yaml:"netdev"`
+	Agent      AgentConfig      `yaml:"agent"`
+}
+
+func Default() Config {
+	return Config{
+		Logging: LoggingConfig{
+			Level:          "info",
+			Format:         "text",
+			File:           "./logs/app.log",
+			ToStdout:       true,
+			MaxSizeMb:      100,
+			MaxBackups:     7,
+			MaxAgeDays:     14,
+			Compress:       true,
+			Tag:            "cloud-ovs-agent",
+			SyslogFacility: "daemon",
+		},
+		Audit: AuditConfig{
+			MaxSizeMb:  100,
+			MaxBackups: 10,
+			MaxAgeDays: 90,
+			Compress:   true,
+		},
+		OVS: OVSConfig{
+			Bridge: "br-int",
+		},
+		Admin: AdminConfig{
+			Socket: "/run/cloud-ovs-agent/admin.sock",
+		},
+		Tracing: TracingConfig{
+			Protocol:    "grpc",
+			SampleRatio: 1,
+		},
+		Netdev: NetdevConfig{
+			MTU:               1500,
+			ReconcileInterval: 30 * time.Second,
+		},
+		Agent: AgentConfig{
+			Workers:        1,
+			StatusInterval: 2 * time.Second,
+		},
 	}
-	return def
 }
 
-func mustBool(key string, def bool, errs *[]string) bool {
-	v := os.Getenv(key)
-	if v == "" {
-		return def
+// Source says where a configuration is read from. Overrides come from the
+// command line and beat both the file and the environment.
+type Source struct {
+	ConfigPath string   // YAML file; $CONFIG_FILE when empty
+	EnvFiles   []string // dotenv files, earlier files winning; ".env" when empty
+	LogLevel   string   // --log-level
+}
+
+// LoadAll resolves the configuration, lowest precedence first:
+//
+//  1. built-in defaults (Default)
+//  2. the YAML file at configPath, or at $CONFIG_FILE when configPath is empty
+//  3. variables from the dotenv files (".env" if none given), earlier files winning
+//  4. the process environment
+//
+// The dotenv files are read, not loaded into the process environment, so calling
+// LoadAll again (e.g. on SIGHUP) picks up edits to them.
+func LoadAll(configPath string, dotenvPaths ...string) (Config, error) {
+	return Source{ConfigPath: configPath, EnvFiles: dotenvPaths}.Load()
+}
+
+// Load resolves the configuration like LoadAll and then applies the overrides.
+func (s Source) Load() (Config, error) {
+	dotenvPaths := s.EnvFiles
+	if len(dotenvPaths) == 0 {
+		dotenvPaths = []string{".env"}
+	}
+	dotenv := make(map[string]string)
+	for i := len(dotenvPaths) - 1; i >= 0; i-- {
+		vars, err := godotenv.Read(dotenvPaths[i])
+		if err != nil {
+			// Missing .env files are fine; everything has a default.
+			continue
+		}
+		for k, v := range vars {
+			dotenv[k] = v
+		}
 	}
 
-	b, err := strconv.ParseBool(v)
-	if err != nil {
-		*errs = append(*errs, key+": invalid bool ("+err.Error()+")")
-		return def
+	env := func(key string) string {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+		return dotenv[key]
+	}
+
+	configPath := s.ConfigPath
+	if configPath == "" {
+		configPath = env("CONFIG_FILE")
+	}
+	return load(configPath, env, s.override)
+}
+
+func (s Source) override(cfg *Config) {
+	if s.LogLevel != "" {
+		cfg.Logging.Level = s.LogLevel
 	}
+}
 
-	return b
+// Load builds the configuration from defaults, the optional YAML file and the
+// current environment, then validates it. All problems are reported in one error.
+func Load(configPath string) (Config, error) {
+	return load(configPath, os.Getenv, nil)
 }
 
-func mustInt(key string, def int, errs *[]string) int {
-	v := os.Getenv(key)
-	if v == "" {
-		return def
+func load(configPath string, env func(string) string, override func(*Config)) (Config, error) {
+	cfg := Default()
+	var errs []string
+
+	if configPath != "" {
+		if err := loadFile(configPath, &cfg); err != nil {
+			errs = append(errs, err.Error())
+		}
 	}
-	n, err := strconv.Atoi(v)
+
+	applyEnv(&cfg, env, &errs)
+	if override != nil {
+		override(&cfg)
+	}
+	errs = append(errs, validate(cfg)...)
+
+	if len(errs) > 0 {
+		return cfg, errors.New(strings.Join(errs, "; "))
+	}
+
+	return cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	raw, err := os.ReadFile(path)
 	if err != nil {
-		*errs = append(*errs, key+": invalid int ("+err.Error()+")")
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config file %s: %w", path, err)
 	}
-	return n
+	return nil
 }
 
-func mustDuration(key string, def time.Duration, errs *[]string) time.Duration {
-	v := os.Getenv(key)
-	if v == "" {
-		return def
+// RestartRequired lists the settings that differ between the running and the
+// reloaded configuration but only take effect on restart.
+func RestartRequired(running, next Config) []string {
+	var fields []string
+	check := func(name string, changed bool) {
+		if changed {
+			fields = append(fields, name)
+		}
 	}
-	d, err := time.ParseDuration(v)
-	if err != nil {
-		*errs = append(*errs, key+": invalid duration ("+err.Error()+")")
-		return def
+	check("audit", running.Audit != next.Audit)
+	check("southbound", running.Southbound != next.Southbound)
+	check("ovs.endpoint", running.OVS.Endpoint != next.OVS.Endpoint)
+	check("ovs.bridge", running.OVS.Bridge != next.OVS.Bridge)
+	check("http.listen", running.HTTP.Listen != next.HTTP.Listen)
+	check("admin", running.Admin != next.Admin)
+	check("tracing", running.Tracing != next.Tracing)
+	check("netdev.netns", running.Netdev.Netns != next.Netdev.Netns)
+	check("agent.chassis", running.Agent.Chassis != next.Agent.Chassis)
+	check("agent.status", running.Agent.Status != next.Agent.Status)
+	check("agent.status_interval", running.Agent.StatusInterval != next.Agent.StatusInterval)
+	check("agent.standalone", running.Agent.Standalone != next.Agent.Standalone)
+	return fields
+}
+
+const redacted = "<redacted>"
+
+// Redacted returns a copy of c that is safe to print: secret values are masked.
+func (c Config) Redacted() Config {
+	if c.Southbound.TLS.PrivateKey != "" {
+		c.Southbound.TLS.PrivateKey = redacted
 	}
-	return d
+	return c
 }
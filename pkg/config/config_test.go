@@ -0,0 +1,232 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile writes content to name in a fresh temporary directory and returns
+// its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "agent.yaml", `
+logging:
+  level: warn
+southbound:
+  remote: tcp:10.0.0.1:6642
+ovs:
+  bridge: br-file
+agent:
+  chassis: hv1
+  workers: 4
+`)
+	tests := []struct {
+		name     string
+		env      map[string]string
+		logLevel string
+		check    func(Config) bool
+	}{
+		{
+			name: "file over defaults",
+			check: func(c Config) bool {
+				return c.Logging.Level == "warn" && c.OVS.Bridge == "br-file" && c.Netdev.MTU == 1500
+			},
+		},
+		{
+			name: "env over file",
+			env:  map[string]string{"OVS_BRIDGE": "br-env", "AGENT_WORKERS": "8"},
+			check: func(c Config) bool {
+				return c.OVS.Bridge == "br-env" && c.Agent.Workers == 8 && c.Logging.Level == "warn"
+			},
+		},
+		{
+			name:  "env remote over file remote",
+			env:   map[string]string{"SOUTHBOUND_REMOTE": "tcp:10.0.0.2:6642"},
+			check: func(c Config) bool { return c.Southbound.Remote == "tcp:10.0.0.2:6642" },
+		},
+		{
+			name:  "legacy env over file remote",
+			env:   map[string]string{"SOUTHBOUND_IP": "10.0.0.3"},
+			check: func(c Config) bool { return c.Southbound.Remote == "tcp:10.0.0.3:6642" },
+		},
+		{
+			name:     "flag over env",
+			env:      map[string]string{"LOG_LEVEL": "error"},
+			logLevel: "debug",
+			check:    func(c Config) bool { return c.Logging.Level == "debug" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := Source{LogLevel: tt.logLevel}
+			cfg, err := load(file, envOf(tt.env), src.override)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("unexpected config %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestSourceLoadDotenv(t *testing.T) {
+	first := writeFile(t, "first.env", "SOUTHBOUND_REMOTE=tcp:10.0.0.1:6642\nOVS_BRIDGE=br-first\nHYPERVISOR_NAME=hv1\n")
+	second := writeFile(t, "second.env", "OVS_BRIDGE=br-second\nNETDEV_MTU=9000\nAGENT_WORKERS=2\n")
+	t.Setenv("AGENT_WORKERS", "3")
+
+	cfg, err := Source{EnvFiles: []string{first, second, "/nonexistent/.env"}}.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.OVS.Bridge != "br-first" {
+		t.Errorf("bridge = %q, want the earlier file's br-first", cfg.OVS.Bridge)
+	}
+	if cfg.Netdev.MTU != 9000 {
+		t.Errorf("mtu = %d, want 9000 from the later file", cfg.Netdev.MTU)
+	}
+	if cfg.Agent.Workers != 3 {
+		t.Errorf("workers = %d, want 3 from the process environment", cfg.Agent.Workers)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		want []string
+	}{
+		{
+			name: "no remote",
+			want: []string{"southbound.remote: is required unless agent.standalone is set"},
+		},
+		{
+			name: "no chassis",
+			env:  map[string]string{"SOUTHBOUND_REMOTE": "tcp:10.0.0.1", "HYPERVISOR_NAME": ""},
+			want: []string{"agent.chassis: is required"},
+		},
+		{
+			name: "standalone without admin socket",
+			file: "agent:\n  standalone: true\nadmin:\n  socket: \"\"\n",
+			want: []string{"admin.socket: is required when agent.standalone is set"},
+		},
+		{
+			name: "standalone needs no remote",
+			env:  map[string]string{"AGENT_STANDALONE": "true"},
+		},
+		{
+			name: "bad remote",
+			env:  map[string]string{"SOUTHBOUND_REMOTE": "10.0.0.1:6642"},
+			want: []string{"southbound.remote: "},
+		},
+		{
+			name: "ssl remote without tls",
+			env:  map[string]string{"SOUTHBOUND_REMOTE": "ssl:sb.example:6642"},
+			want: []string{"southbound.tls: required for ssl remote ssl:sb.example:6642"},
+		},
+		{
+			name: "bad ovs endpoint",
+			env:  map[string]string{"SOUTHBOUND_REMOTE": "tcp:10.0.0.1", "OVS_ENDPOINT": "/run/openvswitch/db.sock"},
+			want: []string{"ovs.endpoint: "},
+		},
+		{
+			name: "bad http port",
+			env:  map[string]string{"SOUTHBOUND_REMOTE": "tcp:10.0.0.1", "HTTP_LISTEN": ":99999"},
+			want: []string{`http.listen: invalid port "99999"`},
+		},
+		{
+			name: "tag checks",
+			env: map[string]string{
+				"SOUTHBOUND_REMOTE":    "tcp:10.0.0.1",
+				"LOG_LEVEL":            "loud",
+				"NETDEV_MTU":           "10",
+				"AGENT_WORKERS":        "0",
+				"TRACING_SAMPLE_RATIO": "2",
+				"TRACING_ENDPOINT":     "collector",
+			},
+			want: []string{
+				"logging.level: loud is not one of",
+				`tracing.endpoint: "collector" is not a host:port`,
+				"tracing.sample_ratio: 2 must be <= 1",
+				"netdev.mtu: 10 must be >= 68",
+				"agent.workers: 0 must be >= 1",
+			},
+		},
+		{
+			name: "unknown offload",
+			env:  map[string]string{"SOUTHBOUND_REMOTE": "tcp:10.0.0.1", "NETDEV_PROFILES": "a:ufo=on"},
+			want: []string{"netdev.profiles[a].offloads[ufo]: "},
+		},
+		{
+			name: "unknown file key",
+			file: "ovs:\n  brige: br-typo\n",
+			env:  map[string]string{"SOUTHBOUND_REMOTE": "tcp:10.0.0.1"},
+			want: []string{"field brige not found"},
+		},
+		{
+			name: "env errors are reported with validation errors",
+			env:  map[string]string{"AGENT_WORKERS": "many"},
+			want: []string{"AGENT_WORKERS: invalid int", "southbound.remote: is required"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path string
+			if tt.file != "" {
+				path = writeFile(t, "agent.yaml", tt.file)
+			}
+			env := map[string]string{"HYPERVISOR_NAME": "hv1"}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			_, err := load(path, envOf(env), nil)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("no error, want %q", tt.want)
+			}
+			got := strings.Split(err.Error(), "; ")
+			if len(got) != len(tt.want) {
+				t.Fatalf("errors = %q, want %d", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("error %d = %q, want it to contain %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+// The shipped templates are meant to be copied as they are, so they must load.
+func TestLoadTemplates(t *testing.T) {
+	tests := []struct {
+		name string
+		src  Source
+	}{
+		{"env", Source{EnvFiles: []string{"../../.env.template"}}},
+		{"yaml", Source{ConfigPath: "../../config.template.yaml", EnvFiles: []string{"/nonexistent/.env"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.src.Load(); err != nil {
+				t.Errorf("%v", strings.ReplaceAll(err.Error(), "; ", "\n"))
+			}
+		})
+	}
+}
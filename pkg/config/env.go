@@ -0,0 +1,254 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyEnv overrides cfg with every variable getenv returns a value for.
+// Malformed values are recorded in errs and leave the current value in place.
+func applyEnv(cfg *Config, getenv func(string) string, errs *[]string) {
+	e := envReader{getenv: getenv, errs: errs}
+
+	e.str("LOG_LEVEL", &cfg.Logging.Level)
+	e.str("LOG_FORMAT", &cfg.Logging.Format)
+	e.stringMap("LOG_LEVELS", &cfg.Logging.Levels)
+	e.str("LOG_FILE", &cfg.Logging.File)
+	e.boolean("LOG_TO_STDOUT", &cfg.Logging.ToStdout)
+	e.integer("LOG_MAX_SIZE_MB", &cfg.Logging.MaxSizeMb)
+	e.integer("LOG_MAX_BACKUPS", &cfg.Logging.MaxBackups)
+	e.integer("LOG_MAX_AGE_DAYS", &cfg.Logging.MaxAgeDays)
+	e.boolean("LOG_COMPRESS", &cfg.Logging.Compress)
+	e.list("LOG_SINKS", &cfg.Logging.Sinks)
+	e.str("LOG_TAG", &cfg.Logging.Tag)
+	e.str("LOG_SYSLOG_FACILITY", &cfg.Logging.SyslogFacility)
+
+	e.str("AUDIT_FILE", &cfg.Audit.File)
+	e.integer("AUDIT_MAX_SIZE_MB", &cfg.Audit.MaxSizeMb)
+	e.integer("AUDIT_MAX_BACKUPS", &cfg.Audit.MaxBackups)
+	e.integer("AUDIT_MAX_AGE_DAYS", &cfg.Audit.MaxAgeDays)
+	e.boolean("AUDIT_COMPRESS", &cfg.Audit.Compress)
+
+	e.str("SOUTHBOUND_REMOTE", &cfg.Southbound.Remote)
+	e.boolean("SOUTHBOUND_LEADER_ONLY", &cfg.Southbound.LeaderOnly)
+	if getenv("SOUTHBOUND_REMOTE") == "" {
+		e.legacyRemote("SOUTHBOUND_IP", "SOUTHBOUND_PORT", &cfg.Southbound.Remote)
+	}
+	e.str("SB_PRIVATE_KEY", &cfg.Southbound.TLS.PrivateKey)
+	e.str("SB_CERTIFICATE", &cfg.Southbound.TLS.Certificate)
+	e.str("SB_CA_CERT", &cfg.Southbound.TLS.CACert)
+	e.str("SB_SERVER_NAME", &cfg.Southbound.TLS.ServerName)
+
+	e.str("OVS_ENDPOINT", &cfg.OVS.Endpoint)
+	e.str("OVS_BRIDGE", &cfg.OVS.Bridge)
+
+	e.str("HTTP_LISTEN", &cfg.HTTP.Listen)
+
+	e.str("ADMIN_SOCKET", &cfg.Admin.Socket)
+	e.str("ADMIN_GROUP", &cfg.Admin.Group)
+
+	e.str("TRACING_ENDPOINT", &cfg.Tracing.Endpoint)
+	e.str("TRACING_PROTOCOL", &cfg.Tracing.Protocol)
+	e.boolean("TRACING_INSECURE", &cfg.Tracing.Insecure)
+	e.float("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+
+	e.integer("NETDEV_MTU", &cfg.Netdev.MTU)
+	e.boolean("NETDEV_REPAIR", &cfg.Netdev.Repair)
+	e.str("NETDEV_NETNS", &cfg.Netdev.Netns)
+	e.duration("NETDEV_RECONCILE_INTERVAL", &cfg.Netdev.ReconcileInterval)
+	e.profiles("NETDEV_PROFILES", &cfg.Netdev.Profiles)
+	e.stringMap("NETDEV_NETWORK_PROFILES", &cfg.Netdev.NetworkProfiles)
+
+	e.str("HYPERVISOR_NAME", &cfg.Agent.Chassis)
+	e.integer("AGENT_WORKERS", &cfg.Agent.Workers)
+	e.boolean("AGENT_STATUS", &cfg.Agent.Status)
+	e.duration("AGENT_STATUS_INTERVAL", &cfg.Agent.StatusInterval)
+	e.boolean("AGENT_STANDALONE", &cfg.Agent.Standalone)
+}
+
+type envReader struct {
+	getenv func(string) string
+	errs   *[]string
+}
+
+// get returns the variable's value. A value starting with "#" is a comment
+// that ended up on the line of an empty variable, e.g. "KEY=   # note" in a
+// dotenv file; it is reported rather than used.
+func (e envReader) get(key string) string {
+	v := e.getenv(key)
+	if strings.HasPrefix(v, "#") {
+		e.fail(key, "value "+strconv.Quote(v)+" looks like a comment (put comments on their own line)")
+		return ""
+	}
+	return v
+}
+
+func (e envReader) fail(key, msg string) {
+	*e.errs = append(*e.errs, key+": "+msg)
+}
+
+func (e envReader) str(key string, dst *string) {
+	if v := e.get(key); v != "" {
+		*dst = v
+	}
+}
+
+func (e envReader) boolean(key string, dst *bool) {
+	v := e.get(key)
+	if v == "" {
+		return
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.fail(key, "invalid bool ("+err.Error()+")")
+		return
+	}
+
+	*dst = b
+}
+
+func (e envReader) integer(key string, dst *int) {
+	v := e.get(key)
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.fail(key, "invalid int ("+err.Error()+")")
+		return
+	}
+	*dst = n
+}
+
+func (e envReader) float(key string, dst *float64) {
+	v := e.get(key)
+	if v == "" {
+		return
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.fail(key, "invalid float ("+err.Error()+")")
+		return
+	}
+	*dst = f
+}
+
+// legacyRemote turns the old host/port pair into a tcp: remote.
+func (e envReader) legacyRemote(hostKey, portKey string, dst *string) {
+	host := e.get(hostKey)
+	if host == "" {
+		return
+	}
+	port := defaultSouthboundPort
+	e.integer(portKey, &port)
+	*dst = Endpoint{Scheme: "tcp", Host: strings.Trim(host, "[]"), Port: port}.String()
+}
+
+func (e envReader) duration(key string, dst *time.Duration) {
+	v := e.get(key)
+	if v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		e.fail(key, "invalid duration ("+err.Error()+")")
+		return
+	}
+	*dst = d
+}
+
+// stringMap parses "k1=v1,k2=v2" and merges it over dst.
+func (e envReader) stringMap(key string, dst *map[string]string) {
+	v := e.get(key)
+	if v == "" {
+		return
+	}
+	if *dst == nil {
+		*dst = make(map[string]string)
+	}
+	for _, kv := range strings.Split(v, ",") {
+		k, val, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok || k == "" || val == "" {
+			e.fail(key, "invalid entry "+strconv.Quote(kv)+" (want key=value)")
+			continue
+		}
+		(*dst)[k] = val
+	}
+}
+
+// list parses "a,b,c" and replaces *dst.
+func (e envReader) list(key string, dst *[]string) {
+	v := e.get(key)
+	if v == "" {
+		return
+	}
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	*dst = out
+}
+
+// profiles parses "name:txqueuelen=N,alias=X,gro=off;name2:..." where every
+// key other than txqueuelen and alias is an offload toggle. Profiles given here
+// replace file profiles of the same name.
+func (e envReader) profiles(key string, dst *map[string]NetdevProfile) {
+	v := e.get(key)
+	if v == "" {
+		return
+	}
+	if *dst == nil {
+		*dst = make(map[string]NetdevProfile)
+	}
+	for _, entry := range strings.Split(v, ";") {
+		name, settings, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || name == "" {
+			e.fail(key, "invalid profile "+strconv.Quote(entry)+" (want name:key=value,...)")
+			continue
+		}
+		var p NetdevProfile
+		for _, kv := range strings.Split(settings, ",") {
+			k, val, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok {
+				e.fail(key, "profile "+name+": invalid setting "+strconv.Quote(kv))
+				continue
+			}
+			switch k {
+			case "txqueuelen":
+				n, err := strconv.Atoi(val)
+				if err != nil {
+					e.fail(key, "profile "+name+": invalid txqueuelen ("+err.Error()+")")
+					continue
+				}
+				p.TxQueueLen = n
+			case "alias":
+				p.Alias = val
+			default:
+				on, err := parseOnOff(val)
+				if err != nil {
+					e.fail(key, "profile "+name+": "+k+": "+err.Error())
+					continue
+				}
+				if p.Offloads == nil {
+					p.Offloads = make(map[string]bool)
+				}
+				p.Offloads[k] = on
+			}
+		}
+		(*dst)[name] = p
+	}
+}
+
+func parseOnOff(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
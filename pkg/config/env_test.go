@@ -0,0 +1,204 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// envOf returns a getenv over vars.
+func envOf(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestApplyEnvLegacyRemote(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+		err  string
+	}{
+		{
+			name: "ip only gets the default port",
+			env:  map[string]string{"SOUTHBOUND_IP": "10.0.0.1"},
+			want: "tcp:10.0.0.1:6642",
+		},
+		{
+			name: "ip and port",
+			env:  map[string]string{"SOUTHBOUND_IP": "10.0.0.1", "SOUTHBOUND_PORT": "16642"},
+			want: "tcp:10.0.0.1:16642",
+		},
+		{
+			name: "ipv6 is bracketed",
+			env:  map[string]string{"SOUTHBOUND_IP": "fd00::1"},
+			want: "tcp:[fd00::1]:6642",
+		},
+		{
+			name: "bracketed ipv6 is not double bracketed",
+			env:  map[string]string{"SOUTHBOUND_IP": "[fd00::1]", "SOUTHBOUND_PORT": "6643"},
+			want: "tcp:[fd00::1]:6643",
+		},
+		{
+			name: "SOUTHBOUND_REMOTE wins",
+			env:  map[string]string{"SOUTHBOUND_REMOTE": "ssl:sb.example:6642", "SOUTHBOUND_IP": "10.0.0.1"},
+			want: "ssl:sb.example:6642",
+		},
+		{
+			name: "port without ip is ignored",
+			env:  map[string]string{"SOUTHBOUND_PORT": "16642"},
+			want: "",
+		},
+		{
+			name: "bad port",
+			env:  map[string]string{"SOUTHBOUND_IP": "10.0.0.1", "SOUTHBOUND_PORT": "x"},
+			want: "tcp:10.0.0.1:6642",
+			err:  "SOUTHBOUND_PORT: invalid int",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			var errs []string
+			applyEnv(&cfg, envOf(tt.env), &errs)
+			if cfg.Southbound.Remote != tt.want {
+				t.Errorf("remote = %q, want %q", cfg.Southbound.Remote, tt.want)
+			}
+			checkErrs(t, errs, tt.err)
+		})
+	}
+}
+
+func TestApplyEnvProfiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[string]NetdevProfile
+		err   string
+	}{
+		{
+			name:  "one profile",
+			value: "nfv:txqueuelen=10000,gro=off,tso=on,alias=vm-{port}",
+			want: map[string]NetdevProfile{
+				"nfv": {TxQueueLen: 10000, Alias: "vm-{port}", Offloads: map[string]bool{"gro": false, "tso": true}},
+			},
+		},
+		{
+			name:  "several profiles, bool offload values",
+			value: "a:txqueuelen=500; b:gso=false,lro=1",
+			want: map[string]NetdevProfile{
+				"a": {TxQueueLen: 500},
+				"b": {Offloads: map[string]bool{"gso": false, "lro": true}},
+			},
+		},
+		{
+			name:  "missing name",
+			value: "txqueuelen=500",
+			want:  map[string]NetdevProfile{},
+			err:   `invalid profile "txqueuelen=500"`,
+		},
+		{
+			name:  "bad txqueuelen keeps the rest",
+			value: "a:txqueuelen=lots,gro=off",
+			want:  map[string]NetdevProfile{"a": {Offloads: map[string]bool{"gro": false}}},
+			err:   "profile a: invalid txqueuelen",
+		},
+		{
+			name:  "bad offload value",
+			value: "a:gro=maybe",
+			want:  map[string]NetdevProfile{"a": {}},
+			err:   "profile a: gro:",
+		},
+		{
+			name:  "setting without a value",
+			value: "a:gro",
+			want:  map[string]NetdevProfile{"a": {}},
+			err:   `profile a: invalid setting "gro"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			var errs []string
+			applyEnv(&cfg, envOf(map[string]string{"NETDEV_PROFILES": tt.value}), &errs)
+			if !reflect.DeepEqual(cfg.Netdev.Profiles, tt.want) {
+				t.Errorf("profiles = %+v, want %+v", cfg.Netdev.Profiles, tt.want)
+			}
+			checkErrs(t, errs, tt.err)
+		})
+	}
+}
+
+func TestApplyEnvValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		check func(Config) bool
+		err   string
+	}{
+		{
+			name: "string map merges",
+			env:  map[string]string{"LOG_LEVELS": "ovs=debug, sb=trace"},
+			check: func(c Config) bool {
+				return reflect.DeepEqual(c.Logging.Levels, map[string]string{"ovs": "debug", "sb": "trace"})
+			},
+		},
+		{
+			name:  "string map entry without a value",
+			env:   map[string]string{"LOG_LEVELS": "ovs"},
+			check: func(c Config) bool { return len(c.Logging.Levels) == 0 },
+			err:   `LOG_LEVELS: invalid entry "ovs"`,
+		},
+		{
+			name:  "list drops empty items",
+			env:   map[string]string{"LOG_SINKS": "file, ,journald"},
+			check: func(c Config) bool { return reflect.DeepEqual(c.Logging.Sinks, []string{"file", "journald"}) },
+		},
+		{
+			name:  "bad bool leaves the value",
+			env:   map[string]string{"LOG_TO_STDOUT": "yes please"},
+			check: func(c Config) bool { return !c.Logging.ToStdout },
+			err:   "LOG_TO_STDOUT: invalid bool",
+		},
+		{
+			name:  "bad duration",
+			env:   map[string]string{"AGENT_STATUS_INTERVAL": "2"},
+			check: func(c Config) bool { return c.Agent.StatusInterval == 0 },
+			err:   "AGENT_STATUS_INTERVAL: invalid duration",
+		},
+		{
+			name:  "comment on an empty value",
+			env:   map[string]string{"NETDEV_NETNS": "# netns name or path"},
+			check: func(c Config) bool { return c.Netdev.Netns == "" },
+			err:   "NETDEV_NETNS: value \"# netns name or path\" looks like a comment",
+		},
+		{
+			name:  "comment on an empty list",
+			env:   map[string]string{"LOG_SINKS": "# file,stdout"},
+			check: func(c Config) bool { return c.Logging.Sinks == nil },
+			err:   "LOG_SINKS: value",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			var errs []string
+			applyEnv(&cfg, envOf(tt.env), &errs)
+			if !tt.check(cfg) {
+				t.Errorf("unexpected config %+v", cfg)
+			}
+			checkErrs(t, errs, tt.err)
+		})
+	}
+}
+
+// checkErrs fails unless errs is empty when want is, or has exactly one error
+// containing want.
+func checkErrs(t *testing.T, errs []string, want string) {
+	t.Helper()
+	switch {
+	case want == "" && len(errs) > 0:
+		t.Errorf("unexpected errors %q", errs)
+	case want != "" && (len(errs) != 1 || !strings.Contains(errs[0], want)):
+		t.Errorf("errors = %q, want one containing %q", errs, want)
+	}
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Endpoint is one OVSDB remote in the connection-method format of ovsdb(7):
+// "tcp:HOST:PORT", "ssl:HOST:PORT" or "unix:PATH", with IPv6 hosts in brackets.
+type Endpoint struct {
+	Scheme string // tcp | ssl | unix
+	Host   string // tcp/ssl only, without brackets
+	Port   int    // tcp/ssl only
+	Path   string // unix only
+}
+
+func (e Endpoint) String() string {
+	if e.Scheme == "unix" {
+		return "unix:" + e.Path
+	}
+	return e.Scheme + ":" + net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// ParseRemote parses a comma-separated list of OVSDB remotes, such as
+// "ssl:[fd00::1]:6642,ssl:10.0.0.2:6642". tcp/ssl remotes without a port get
+// defaultPort.
+func ParseRemote(remote string, defaultPort int) ([]Endpoint, error) {
+	var eps []Endpoint
+	for _, raw := range strings.Split(remote, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		ep, err := parseEndpoint(raw, defaultPort)
+		if err != nil {
+			return nil, err
+		}
+		eps = append(eps, ep)
+	}
+	if len(eps) == 0 {
+		return nil, fmt.Errorf("no endpoints in %q", remote)
+	}
+	return eps, nil
+}
+
+func parseEndpoint(raw string, defaultPort int) (Endpoint, error) {
+	scheme, rest, ok := strings.Cut(raw, ":")
+	if !ok {
+		return Endpoint{}, fmt.Errorf("%q: missing scheme (want tcp:, ssl: or unix:)", raw)
+	}
+
+	switch scheme {
+	case "unix":
+		if rest == "" {
+			return Endpoint{}, fmt.Errorf("%q: missing socket path", raw)
+		}
+		return Endpoint{Scheme: scheme, Path: rest}, nil
+	case "tcp", "ssl":
+	default:
+		return Endpoint{}, fmt.Errorf("%q: unsupported scheme %q (want tcp, ssl or unix)", raw, scheme)
+	}
+
+	host, port, hasPort := rest, "", false
+	if strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return Endpoint{}, fmt.Errorf("%q: unterminated [ in IPv6 address", raw)
+		}
+		host = rest[1:end]
+		if tail := rest[end+1:]; tail != "" {
+			if !strings.HasPrefix(tail, ":") {
+				return Endpoint{}, fmt.Errorf("%q: unexpected %q after IPv6 address", raw, tail)
+			}
+			port, hasPort = tail[1:], true
+		}
+		if ip := net.ParseIP(host); ip == nil || ip.To4() != nil {
+			return Endpoint{}, fmt.Errorf("%q: %q is not an IPv6 address", raw, host)
+		}
+	} else {
+		if strings.Count(rest, ":") > 1 {
+			return Endpoint{}, fmt.Errorf("%q: IPv6 addresses must be written in brackets, e.g. %s:[fd00::1]:6642", raw, scheme)
+		}
+		host, port, hasPort = strings.Cut(rest, ":")
+		if host == "" {
+			return Endpoint{}, fmt.Errorf("%q: missing host", raw)
+		}
+		if net.ParseIP(host) == nil && !isHostname(host) {
+			return Endpoint{}, fmt.Errorf("%q: %q is not a valid hostname or IP", raw, host)
+		}
+	}
+
+	ep := Endpoint{Scheme: scheme, Host: host, Port: defaultPort}
+	if hasPort {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return Endpoint{}, fmt.Errorf("%q: invalid port %q", raw, port)
+		}
+		ep.Port = n
+	}
+	return ep, nil
+}
+
+// isHostname applies the RFC 1123 label rules.
+func isHostname(s string) bool {
+	if len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   []Endpoint
+		err    string
+	}{
+		{remote: "tcp:10.0.0.1:6642", want: []Endpoint{{Scheme: "tcp", Host: "10.0.0.1", Port: 6642}}},
+		{remote: "ssl:sb.example.com:16642", want: []Endpoint{{Scheme: "ssl", Host: "sb.example.com", Port: 16642}}},
+		{remote: "tcp:10.0.0.1", want: []Endpoint{{Scheme: "tcp", Host: "10.0.0.1", Port: 6642}}},
+		{remote: "tcp:[::1]:6643", want: []Endpoint{{Scheme: "tcp", Host: "::1", Port: 6643}}},
+		{remote: "ssl:[fd00::1]", want: []Endpoint{{Scheme: "ssl", Host: "fd00::1", Port: 6642}}},
+		{remote: "unix:/var/run/ovn/ovnsb_db.sock", want: []Endpoint{{Scheme: "unix", Path: "/var/run/ovn/ovnsb_db.sock"}}},
+		{
+			remote: "ssl:[fd00::1]:6642, ssl:10.0.0.2:6642,,unix:/run/sb.sock",
+			want: []Endpoint{
+				{Scheme: "ssl", Host: "fd00::1", Port: 6642},
+				{Scheme: "ssl", Host: "10.0.0.2", Port: 6642},
+				{Scheme: "unix", Path: "/run/sb.sock"},
+			},
+		},
+
+		{remote: "", err: `no endpoints in ""`},
+		{remote: " , ", err: "no endpoints in"},
+		{remote: "10.0.0.1", err: "missing scheme"},
+		{remote: "[::1]:6642", err: `unsupported scheme "["`},
+		{remote: "http:10.0.0.1:6642", err: `unsupported scheme "http"`},
+		{remote: "unix:", err: "missing socket path"},
+		{remote: "tcp:10.0.0.1:", err: `invalid port ""`},
+		{remote: "tcp:[::1]:", err: `invalid port ""`},
+		{remote: "tcp:10.0.0.1:0", err: `invalid port "0"`},
+		{remote: "tcp:10.0.0.1:65536", err: `invalid port "65536"`},
+		{remote: "tcp:10.0.0.1:ovsdb", err: `invalid port "ovsdb"`},
+		{remote: "tcp::6642", err: "missing host"},
+		{remote: "tcp:bad_host:6642", err: "not a valid hostname or IP"},
+		{remote: "tcp:::1:6642", err: "IPv6 addresses must be written in brackets"},
+		{remote: "tcp:[::1", err: "unterminated ["},
+		{remote: "tcp:[::1]6642", err: "after IPv6 address"},
+		{remote: "tcp:[10.0.0.1]:6642", err: "is not an IPv6 address"},
+		{remote: "tcp:10.0.0.1:6642,tcp:10.0.0.2:x", err: `"tcp:10.0.0.2:x": invalid port`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.remote, func(t *testing.T) {
+			got, err := ParseRemote(tt.remote, 6642)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpointString(t *testing.T) {
+	for _, remote := range []string{"tcp:10.0.0.1:6642", "ssl:[fd00::1]:6642", "unix:/run/sb.sock"} {
+		eps, err := ParseRemote(remote, 6642)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := eps[0].String(); got != remote {
+			t.Errorf("String() = %q, want %q", got, remote)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var validate = newValidator()
+
+func newValidator() func(Config) []string {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	// Report fields by their YAML path, which is what operators write.
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	return func(cfg Config) []string {
+		out := checkRemotes(cfg)
+
+		err := v.Struct(cfg)
+		if err == nil {
+			return out
+		}
+
+		var verrs validator.ValidationErrors
+		if !errors.As(err, &verrs) {
+			return append(out, err.Error())
+		}
+
+		for _, fe := range verrs {
+			// Namespace is "Config.section.field"; drop the root type.
+			_, field, _ := strings.Cut(fe.Namespace(), ".")
+			out = append(out, fmt.Sprintf("%s: %s", field, describe(fe)))
+		}
+		return out
+	}
+}
+
+// checkRemotes validates the OVSDB remote strings and the HTTP listen
+// address, which need more than tags, and that a standalone agent can be
+// reached.
+func checkRemotes(cfg Config) []string {
+	var out []string
+	switch {
+	case cfg.Agent.Standalone && cfg.Admin.Socket == "":
+		out = append(out, "admin.socket: is required when agent.standalone is set")
+	case !cfg.Agent.Standalone && cfg.Southbound.Remote == "":
+		out = append(out, "southbound.remote: is required unless agent.standalone is set")
+	}
+	if cfg.Southbound.Remote != "" {
+		eps, err := cfg.Southbound.Endpoints()
+		if err != nil {
+			out = append(out, "southbound.remote: "+err.Error())
+		}
+		for _, ep := range eps {
+			if ep.Scheme == "ssl" && !cfg.Southbound.TLS.Enabled() {
+				out = append(out, "southbound.tls: required for ssl remote "+ep.String())
+				break
+			}
+		}
+	}
+	if cfg.OVS.Endpoint != "" {
+		if _, err := ParseRemote(cfg.OVS.Endpoint, defaultOVSPort); err != nil {
+			out = append(out, "ovs.endpoint: "+err.Error())
+		}
+	}
+	if cfg.HTTP.Listen != "" {
+		if _, port, err := net.SplitHostPort(cfg.HTTP.Listen); err != nil {
+			out = append(out, "http.listen: "+err.Error())
+		} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+			out = append(out, fmt.Sprintf("http.listen: invalid port %q", port))
+		}
+	}
+	return out
+}
+
+func describe(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_with":
+		return "is required when any of " + fe.Param() + " is set"
+	case "file":
+		return fmt.Sprintf("%q is not a readable file", fe.Value())
+	case "oneof":
+		return fmt.Sprintf("%v is not one of [%s]", fe.Value(), fe.Param())
+	case "hostname_rfc1123", "hostname_rfc1123|ip":
+		return fmt.Sprintf("%q is not a valid hostname or IP", fe.Value())
+	case "hostname_port":
+		return fmt.Sprintf("%q is not a host:port", fe.Value())
+	case "gt", "gte", "lte", "min", "max":
+		return fmt.Sprintf("%v must be %s %s", fe.Value(), comparison[fe.Tag()], fe.Param())
+	}
+	return fmt.Sprintf("%v fails %q", fe.Value(), fe.Tag())
+}
+
+var comparison = map[string]string{
+	"gt":  ">",
+	"gte": ">=",
+	"lte": "<=",
+	"min": ">=",
+	"max": "<=",
+}
@@ -0,0 +1,151 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalHandler writes records to journald over its native datagram
+// protocol, so fields such as logical_port become journal fields
+// (LOGICAL_PORT=...) that journalctl can match on.
+type journalHandler struct {
+	conn *net.UnixConn
+	tag  string
+	mu   *sync.Mutex
+	set  attrSet
+}
+
+func newJournalHandler(tag string) (*journalHandler, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalHandler{conn: conn, tag: tag, mu: &sync.Mutex{}}, nil
+}
+
+func (h *journalHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *journalHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+	appendJournalField(&buf, "MESSAGE", r.Message)
+	appendJournalField(&buf, "PRIORITY", strconv.Itoa(severity(r.Level)))
+	appendJournalField(&buf, "SYSLOG_IDENTIFIER", h.tag)
+	if r.PC != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		appendJournalField(&buf, "CODE_FILE", f.File)
+		appendJournalField(&buf, "CODE_LINE", strconv.Itoa(f.Line))
+		appendJournalField(&buf, "CODE_FUNC", f.Function)
+	}
+	h.set.each(r, func(key string, v slog.Value) {
+		appendJournalField(&buf, journalFieldName(key), v.String())
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.conn.Write(buf.Bytes())
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		// Too large for one datagram: hand journald a sealed memfd instead.
+		err = h.sendMemfd(buf.Bytes())
+	}
+	return err
+}
+
+func (h *journalHandler) sendMemfd(data []byte) error {
+	fd, err := unix.MemfdCreate("journal-entry", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return fmt.Errorf("memfd_create: %w", err)
+	}
+	f := os.NewFile(uintptr(fd), "journal-entry")
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	seals := unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE | unix.F_SEAL_SEAL
+	if _, err := unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, seals); err != nil {
+		return fmt.Errorf("seal memfd: %w", err)
+	}
+	_, _, err = h.conn.WriteMsgUnix(nil, unix.UnixRights(int(f.Fd())), nil)
+	return err
+}
+
+func (h *journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.set = h.set.withAttrs(attrs)
+	return &c
+}
+
+func (h *journalHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.set = h.set.withGroup(name)
+	return &c
+}
+
+func (h *journalHandler) Close() error {
+	return h.conn.Close()
+}
+
+// appendJournalField uses the binary form for values containing newlines.
+func appendJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.ContainsRune(value, '\n') {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalFields are the fields the handler writes itself or that journald
+// gives a meaning to. Record keys mapping to one of them get the F_ prefix, so
+// an attribute named "message" cannot add a second MESSAGE.
+var journalFields = map[string]bool{
+	"MESSAGE": true, "MESSAGE_ID": true, "PRIORITY": true, "ERRNO": true,
+	"CODE_FILE": true, "CODE_LINE": true, "CODE_FUNC": true,
+	"SYSLOG_IDENTIFIER": true, "SYSLOG_FACILITY": true, "SYSLOG_PID": true, "SYSLOG_TIMESTAMP": true,
+	"DOCUMENTATION": true, "TID": true,
+}
+
+// journalFieldName turns a record key into a valid journal field name:
+// upper case letters, digits and underscores, not starting with an
+// underscore (reserved for trusted fields) or a digit, and not one of
+// journalFields.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	name = strings.TrimLeft(name, "_")
+	if name == "" || name[0] >= '0' && name[0] <= '9' || journalFields[name] {
+		name = "F_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJournalFieldName(t *testing.T) {
+	tests := []struct{ key, want string }{
+		{"logical_port", "LOGICAL_PORT"},
+		{"ifname", "IFNAME"},
+		{"old-mtu", "OLD_MTU"},
+		{"span.id", "SPAN_ID"},
+		{"_hidden", "HIDDEN"},
+		{"9lives", "F_9LIVES"},
+		{"", "F_"},
+		{"___", "F_"},
+		{"message", "F_MESSAGE"},
+		{"Priority", "F_PRIORITY"},
+		{"code_file", "F_CODE_FILE"},
+		{"syslog_identifier", "F_SYSLOG_IDENTIFIER"},
+		{"message_text", "MESSAGE_TEXT"},
+		{strings.Repeat("a", 70), strings.Repeat("A", 64)},
+	}
+	for _, tt := range tests {
+		if got := journalFieldName(tt.key); got != tt.want {
+			t.Errorf("journalFieldName(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	tests := []struct {
+		lv   Level
+		want int
+	}{
+		{LevelTrace, 7},
+		{LevelDebug, 7},
+		{LevelInfo, 6},
+		{LevelWarn, 4},
+		{LevelError, 3},
+		{LevelError + 4, 3},
+	}
+	for _, tt := range tests {
+		if got := severity(tt.lv); got != tt.want {
+			t.Errorf("severity(%v) = %d, want %d", tt.lv, got, tt.want)
+		}
+	}
+}
+
+func TestJournalHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	srv, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &journalHandler{conn: conn, tag: "agent", mu: &sync.Mutex{}}
+	defer h.Close()
+
+	r := slog.NewRecord(time.Now(), LevelWarn, "link drift", 0)
+	r.Add("message", "from an attribute", KeyIfname, "vm1", "detail", "line one\nline two")
+	if err := h.WithAttrs([]slog.Attr{slog.String(KeySubsystem, "netdev")}).Handle(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	n, err := srv.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(buf[:n])
+	for _, want := range []string{
+		"MESSAGE=link drift\n",
+		"PRIORITY=4\n",
+		"SYSLOG_IDENTIFIER=agent\n",
+		"SUBSYSTEM=netdev\n",
+		"F_MESSAGE=from an attribute\n",
+		"IFNAME=vm1\n",
+		"DETAIL\n\x11\x00\x00\x00\x00\x00\x00\x00line one\nline two\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("entry lacks %q:\n%q", want, got)
+		}
+	}
+	if c := strings.Count("\n"+got, "\nMESSAGE="); c != 1 {
+		t.Errorf("entry has %d MESSAGE fields, want 1:\n%q", c, got)
+	}
+}
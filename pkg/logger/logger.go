@@ -1,100 +1,302 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"runtime"
 	"strings"
-	"sync/atomic"
+	"sync"
+	"time"
 
 	"github.com/yangjie500/cloud-ovs-agent/pkg/config"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-type Level int32
+type Level = slog.Level
 
 const (
-	Debug Level = iota
-	Info
-	Warn
-	Error
+	LevelTrace = slog.LevelDebug - 4 // library internals, e.g. libovsdb cache rows
+	LevelDebug = slog.LevelDebug
+	LevelInfo  = slog.LevelInfo
+	LevelWarn  = slog.LevelWarn
+	LevelError = slog.LevelError
 )
 
-var (
-	currentLevel atomic.Int32
-	logger       *log.Logger
+// Field keys shared by every package, so one port can be followed across
+// the SB, netdev and OVS logs.
+const (
+	KeyLogicalPort = "logical_port"
+	KeyIfname      = "ifname"
+	KeyDatapath    = "datapath"
+	KeyOp          = "op"
+	KeyErr         = "err"
+	KeySubsystem   = "subsystem"
 )
 
-func init() {
-	config, err := config.LoadAll(".env")
-	if err != nil {
-		log.Fatalf("Error reading configuration: %v", err)
+// ParseLevel maps trace|debug|info|warn|error to a Level; anything else is Info.
+func ParseLevel(s string) Level {
+	switch strings.ToLower(s) {
+	case "trace":
+		return LevelTrace
+	case "debug":
+		return LevelDebug
+	case "warn":
+		return LevelWarn
+	case "error":
+		return LevelError
+	default:
+		return LevelInfo
+	}
+}
+
+// Logger writes leveled, structured records to its sinks: stdout and a
+// rotated file (as text or JSON), journald and syslog. Loggers derived with
+// With or Named share the sinks of their parent, so Reconfigure on the root
+// applies to all of them.
+type Logger struct {
+	*sinks
+	level *slog.LevelVar // the root's, or the subsystem's for Named loggers
+	attrs []any
+}
+
+type sinks struct {
+	root slog.LevelVar
+
+	mu        sync.RWMutex
+	handler   slog.Handler
+	closers   []io.Closer               // open files and sockets behind handler
+	subs      map[string]*slog.LevelVar // subsystem -> effective level
+	overrides map[string]Level          // subsystems not following the root level
+}
+
+func newLogger() *Logger {
+	s := &sinks{subs: make(map[string]*slog.LevelVar), overrides: make(map[string]Level)}
+	return &Logger{sinks: s, level: &s.root}
+}
+
+// New builds a logger from cfg. Close it to release the log file.
+func New(cfg config.LoggingConfig) *Logger {
+	l := newLogger()
+	l.Reconfigure(cfg)
+	return l
+}
+
+// newStderr is the logger used before Init: info level, text on stderr.
+func newStderr() *Logger {
+	l := newLogger()
+	l.handler = newHandler(os.Stderr, "text")
+	return l
+}
+
+// newHandler accepts every level; Logger.Enabled filters per subsystem.
+func newHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{
+		AddSource: true,
+		Level:     LevelTrace,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			switch {
+			case len(groups) > 0:
+			case a.Key == slog.TimeKey:
+				// Use UTC timestamps for consistency across hosts/regions.
+				a.Value = slog.TimeValue(a.Value.Time().UTC())
+			case a.Key == slog.LevelKey:
+				if lv, ok := a.Value.Any().(slog.Level); ok && lv <= LevelTrace {
+					a.Value = slog.StringValue("TRACE")
+				}
+			case a.Key == slog.SourceKey:
+				if src, ok := a.Value.Any().(*slog.Source); ok {
+					a.Value = slog.StringValue(fmt.Sprintf("%s:%d", shortFile(src.File), src.Line))
+				}
+			}
+			return a
+		},
+	}
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
 	}
-	initWriters(config)
-	SetLevelFromEnv(config)
+	return slog.NewTextHandler(w, opts)
 }
 
-func initWriters(cfg config.Config) {
-	rot := &lumberjack.Logger{
-		Filename:   cfg.LogFile,
-		MaxSize:    cfg.LogMaxSizeMb,
-		MaxBackups: cfg.LogMaxBackups,
-		MaxAge:     cfg.LogMaxAgeDays,
-		Compress:   cfg.LogCompress,
+func shortFile(path string) string {
+	if i := strings.LastIndexByte(path, '/'); i >= 0 {
+		return path[i+1:]
 	}
+	return path
+}
 
-	var w io.Writer = rot
-	if cfg.LogToStdout {
-		w = io.MultiWriter(os.Stdout, rot)
+// Reconfigure replaces the sinks, format and levels of l, e.g. after a config reload.
+func (l *Logger) Reconfigure(cfg config.LoggingConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	old := l.closers
+	l.handler, l.closers = openSinks(cfg)
+	l.root.Set(ParseLevel(cfg.Level))
+	l.overrides = make(map[string]Level, len(cfg.Levels))
+	for name, lv := range cfg.Levels {
+		l.overrides[name] = ParseLevel(lv)
 	}
-	// Use UTC timestamps for consistency across hosts/regions.
-	flags := log.LstdFlags | log.Lmicroseconds | log.Lshortfile | log.LUTC
-	logger = log.New(w, "", flags)
+	l.syncSubsystemsLocked()
+
+	closeAll(old)
 }
 
-func SetLevel(l Level) {
-	currentLevel.Store(int32(l))
+// SetLevel changes the level of l: the root level, which subsystems without
+// their own level follow, or the level of l's subsystem.
+func (l *Logger) SetLevel(lv Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.level == &l.root {
+		l.root.Set(lv)
+		l.syncSubsystemsLocked()
+		return
+	}
+	l.level.Set(lv)
+	for name, v := range l.subs {
+		if v == l.level {
+			l.overrides[name] = lv
+		}
+	}
 }
 
-func SetLevelFromEnv(cfg config.Config) {
-	levelStr := strings.ToLower(cfg.LogLevel)
-	fmt.Println(levelStr)
-	switch levelStr {
-	case "debug":
-		SetLevel(Debug)
-	case "info":
-		SetLevel(Info)
-	case "warn":
-		SetLevel(Warn)
-	case "error":
-		SetLevel(Error)
-	default:
-		SetLevel(Info)
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := closeAll(l.closers)
+	l.closers = nil
+	return err
+}
+
+// With returns a logger that adds the given key/value pairs to every record.
+func (l *Logger) With(args ...any) *Logger {
+	attrs := make([]any, 0, len(l.attrs)+len(args))
+	attrs = append(append(attrs, l.attrs...), args...)
+	return &Logger{sinks: l.sinks, level: l.level, attrs: attrs}
+}
+
+func (l *Logger) Enabled(lv Level) bool {
+	return lv >= l.level.Level()
+}
+
+// log emits one record. skip is the number of logger frames above log, so the
+// record's source is the code that called the logger.
+func (l *Logger) log(ctx context.Context, lv Level, skip int, msg string, args []any) {
+	if !l.Enabled(lv) {
+		return
 	}
+	var pcs [1]uintptr
+	runtime.Callers(skip+2, pcs[:]) // skip runtime.Callers and log
+	r := slog.NewRecord(time.Now(), lv, msg, pcs[0])
+	r.Add(l.attrs...)
+	r.Add(args...)
+
+	l.mu.RLock()
+	h := l.handler
+	l.mu.RUnlock()
+	_ = h.Handle(ctx, r)
 }
 
-func logf(l Level, prefix, format string, args ...interface{}) {
-	if l < Level(currentLevel.Load()) {
+// logf formats only when the level is enabled; it adds a frame to log's skip.
+func (l *Logger) logf(lv Level, format string, args []any) {
+	if !l.Enabled(lv) {
 		return
 	}
+	l.log(context.Background(), lv, 2, fmt.Sprintf(format, args...), nil)
+}
+
+func (l *Logger) Debug(msg string, args ...any) {
+	l.log(context.Background(), LevelDebug, 1, msg, args)
+}
+
+func (l *Logger) Info(msg string, args ...any) {
+	l.log(context.Background(), LevelInfo, 1, msg, args)
+}
+
+func (l *Logger) Warn(msg string, args ...any) {
+	l.log(context.Background(), LevelWarn, 1, msg, args)
+}
+
+func (l *Logger) Error(msg string, args ...any) {
+	l.log(context.Background(), LevelError, 1, msg, args)
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(LevelDebug, format, args)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(LevelInfo, format, args)
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(LevelWarn, format, args)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(LevelError, format, args)
+}
+
+// std backs the package-level functions and Named. It logs to stderr until
+// Init. It is never replaced, so subsystem loggers taken at package init keep
+// working after Init and Reconfigure.
+var std = newStderr()
+
+// Init configures the default logger from cfg and returns it. Call it once
+// the configuration is loaded.
+func Init(cfg config.LoggingConfig) *Logger {
+	std.Reconfigure(cfg)
+	return std
+}
+
+// Default returns the logger behind the package-level functions.
+func Default() *Logger {
+	return std
+}
+
+// Reconfigure replaces the sinks, format and level of the default logger.
+func Reconfigure(cfg config.LoggingConfig) {
+	Default().Reconfigure(cfg)
+}
+
+func SetLevel(lv Level) {
+	Default().SetLevel(lv)
+}
+
+// With returns the default logger with the given key/value pairs attached.
+func With(args ...any) *Logger {
+	return Default().With(args...)
+}
+
+func Debug(msg string, args ...any) {
+	Default().log(context.Background(), LevelDebug, 1, msg, args)
+}
+
+func Info(msg string, args ...any) {
+	Default().log(context.Background(), LevelInfo, 1, msg, args)
+}
+
+func Warn(msg string, args ...any) {
+	Default().log(context.Background(), LevelWarn, 1, msg, args)
+}
 
-	msg := fmt.Sprintf(format, args...)
-	logger.Output(4, fmt.Sprintf("[%s] %s", prefix, msg))
+func Error(msg string, args ...any) {
+	Default().log(context.Background(), LevelError, 1, msg, args)
 }
 
 func Debugf(format string, args ...interface{}) {
-	logf(Debug, "DEBUG", format, args...)
+	Default().logf(LevelDebug, format, args)
 }
 
 func Infof(format string, args ...interface{}) {
-	logf(Info, "INFO", format, args...)
+	Default().logf(LevelInfo, format, args)
 }
 
 func Warnf(format string, args ...interface{}) {
-	logf(Warn, "WARN", format, args...)
+	Default().logf(LevelWarn, format, args)
 }
 
 func Errorf(format string, args ...interface{}) {
-	logf(Error, "ERROR", format, args...)
+	Default().logf(LevelError, format, args)
 }
@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+)
+
+// vLevel maps logr verbosity to a level. libovsdb logs connection and leader
+// changes at V(2)-V(3) and every cache row at V(5), so only the latter are
+// kept below debug.
+func vLevel(v int) Level {
+	switch {
+	case v <= 3:
+		return LevelInfo
+	case v == 4:
+		return LevelDebug
+	default:
+		return LevelTrace
+	}
+}
+
+// Logr returns l as a logr.Logger, for libraries such as libovsdb
+// (client.WithLogger). Records keep l's subsystem, fields and level.
+func (l *Logger) Logr() logr.Logger {
+	return logr.New(&logrSink{l: l})
+}
+
+type logrSink struct {
+	l     *Logger
+	name  string
+	depth int
+}
+
+var (
+	_ logr.LogSink          = (*logrSink)(nil)
+	_ logr.CallDepthLogSink = (*logrSink)(nil)
+)
+
+func (s *logrSink) Init(info logr.RuntimeInfo) {
+	s.depth += info.CallDepth
+}
+
+func (s *logrSink) Enabled(v int) bool {
+	return s.l.Enabled(vLevel(v))
+}
+
+// Info and Error are one frame below logr.Logger, plus any WithCallDepth.
+func (s *logrSink) Info(v int, msg string, kv ...any) {
+	s.l.log(context.Background(), vLevel(v), 1+s.depth, msg, s.args(nil, kv))
+}
+
+func (s *logrSink) Error(err error, msg string, kv ...any) {
+	s.l.log(context.Background(), LevelError, 1+s.depth, msg, s.args([]any{KeyErr, err}, kv))
+}
+
+func (s *logrSink) args(head, kv []any) []any {
+	if s.name != "" {
+		head = append(head, "logger", s.name)
+	}
+	return append(head, kv...)
+}
+
+func (s *logrSink) WithValues(kv ...any) logr.LogSink {
+	c := *s
+	c.l = s.l.With(kv...)
+	return &c
+}
+
+func (s *logrSink) WithName(name string) logr.LogSink {
+	c := *s
+	if s.name != "" {
+		name = s.name + "/" + name
+	}
+	c.name = name
+	return &c
+}
+
+func (s *logrSink) WithCallDepth(depth int) logr.LogSink {
+	c := *s
+	c.depth += depth
+	return &c
+}
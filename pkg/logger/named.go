@@ -0,0 +1,42 @@
+package logger
+
+import "log/slog"
+
+// Subsystems are the names passed to Named by the agent's packages. Each can
+// have its own level (logging.levels / LOG_LEVELS=ovs=debug,sb=info).
+var Subsystems = []string{"ovs", "sb", "netdev", "agent", "config"}
+
+// Named returns a logger for one subsystem. Its records carry a subsystem
+// field and are filtered by the subsystem's level, which follows the root
+// level unless set on its own.
+func (l *Logger) Named(name string) *Logger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lv, ok := l.subs[name]
+	if !ok {
+		lv = new(slog.LevelVar)
+		lv.Set(l.levelForLocked(name))
+		l.subs[name] = lv
+	}
+	attrs := append(l.attrs[:len(l.attrs):len(l.attrs)], KeySubsystem, name)
+	return &Logger{sinks: l.sinks, level: lv, attrs: attrs}
+}
+
+// Named returns a subsystem logger of the default logger.
+func Named(name string) *Logger {
+	return std.Named(name)
+}
+
+func (l *Logger) levelForLocked(name string) Level {
+	if lv, ok := l.overrides[name]; ok {
+		return lv
+	}
+	return l.root.Level()
+}
+
+func (l *Logger) syncSubsystemsLocked() {
+	for name, lv := range l.subs {
+		lv.Set(l.levelForLocked(name))
+	}
+}
@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yangjie500/cloud-ovs-agent/pkg/config"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Level
+	}{
+		{"trace", LevelTrace},
+		{"debug", LevelDebug},
+		{"DEBUG", LevelDebug},
+		{"info", LevelInfo},
+		{"warn", LevelWarn},
+		{"error", LevelError},
+		{"", LevelInfo},
+		{"loud", LevelInfo},
+	}
+	for _, tt := range tests {
+		if got := ParseLevel(tt.in); got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// newFileLogger returns a logger writing text records to a file, and a
+// function that closes the logger and returns what was written.
+func newFileLogger(t *testing.T, level string, levels map[string]string) (*Logger, func() string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "agent.log")
+	cfg := config.LoggingConfig{Level: level, Levels: levels, Format: "text", File: path, Sinks: []string{"file"}}
+	l := New(cfg)
+	return l, func() string {
+		l.Close()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+}
+
+func TestNamedLevels(t *testing.T) {
+	l, _ := newFileLogger(t, "info", map[string]string{"ovs": "debug", "sb": "error"})
+	for _, name := range Subsystems {
+		want := LevelInfo
+		switch name {
+		case "ovs":
+			want = LevelDebug
+		case "sb":
+			want = LevelError
+		}
+		if got := l.Named(name).level.Level(); got != want {
+			t.Errorf("%s level = %v, want %v", name, got, want)
+		}
+	}
+
+	ovs, netdev := l.Named("ovs"), l.Named("netdev")
+
+	// Subsystems without their own level follow the root.
+	l.SetLevel(LevelWarn)
+	if netdev.Enabled(LevelInfo) || !netdev.Enabled(LevelWarn) {
+		t.Error("netdev did not follow the root level to warn")
+	}
+	if !ovs.Enabled(LevelDebug) {
+		t.Error("ovs lost its own debug level when the root changed")
+	}
+
+	// A subsystem's own level sticks until a reload drops it.
+	netdev.SetLevel(LevelTrace)
+	l.SetLevel(LevelError)
+	if !l.Named("netdev").Enabled(LevelTrace) {
+		t.Error("netdev lost the level set on it")
+	}
+	l.Reconfigure(config.LoggingConfig{Level: "info", Format: "text", Sinks: []string{"file"}, File: filepath.Join(t.TempDir(), "agent.log")})
+	if ovs.Enabled(LevelDebug) || netdev.Enabled(LevelDebug) || !ovs.Enabled(LevelInfo) {
+		t.Error("subsystem levels survived a reload without logging.levels")
+	}
+	l.Close()
+}
+
+func TestNamedRecords(t *testing.T) {
+	l, output := newFileLogger(t, "info", map[string]string{"ovs": "debug"})
+	l.Named("ovs").Debug("ovs debug", KeyIfname, "vm1")
+	l.Named("sb").Debug("sb debug")
+	l.Named("sb").With(KeyLogicalPort, "lp1").Info("sb info")
+
+	out := output()
+	for _, want := range []string{
+		`level=DEBUG source=named_test.go:`,
+		`msg="ovs debug" subsystem=ovs ifname=vm1`,
+		`msg="sb info" subsystem=sb logical_port=lp1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "sb debug") {
+		t.Errorf("sb debug record was written at info level:\n%s", out)
+	}
+}
@@ -0,0 +1,184 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/yangjie500/cloud-ovs-agent/pkg/config"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// openSinks builds one handler per configured sink. A sink that cannot be
+// opened (e.g. no journald on this host) is reported on stderr and skipped;
+// if none can be opened the logger falls back to stderr.
+func openSinks(cfg config.LoggingConfig) (slog.Handler, []io.Closer) {
+	var (
+		handlers []slog.Handler
+		closers  []io.Closer
+	)
+	for _, name := range cfg.SinkNames() {
+		switch name {
+		case "stdout":
+			handlers = append(handlers, newHandler(os.Stdout, cfg.Format))
+		case "file":
+			rot := &lumberjack.Logger{
+				Filename:   cfg.File,
+				MaxSize:    cfg.MaxSizeMb,
+				MaxBackups: cfg.MaxBackups,
+				MaxAge:     cfg.MaxAgeDays,
+				Compress:   cfg.Compress,
+			}
+			handlers = append(handlers, newHandler(rot, cfg.Format))
+			closers = append(closers, rot)
+		case "journald":
+			h, err := newJournalHandler(cfg.Tag)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "logger: journald sink unavailable: %v\n", err)
+				continue
+			}
+			handlers = append(handlers, h)
+			closers = append(closers, h)
+		case "syslog":
+			h, err := newSyslogHandler(cfg.Tag, cfg.SyslogFacility)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "logger: syslog sink unavailable: %v\n", err)
+				continue
+			}
+			handlers = append(handlers, h)
+			closers = append(closers, h)
+		default:
+			fmt.Fprintf(os.Stderr, "logger: unknown sink %q\n", name)
+		}
+	}
+
+	switch len(handlers) {
+	case 0:
+		return newHandler(os.Stderr, cfg.Format), nil
+	case 1:
+		return handlers[0], closers
+	}
+	return fanout(handlers), closers
+}
+
+func closeAll(closers []io.Closer) error {
+	var errs []error
+	for _, c := range closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// severity maps a level to a syslog severity, shared by journald and syslog.
+func severity(lv Level) int {
+	switch {
+	case lv >= LevelError:
+		return 3 // err
+	case lv >= LevelWarn:
+		return 4 // warning
+	case lv >= LevelInfo:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
+
+// fanout sends every record to each of its handlers.
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, lv slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, lv) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanout, len(f))
+	for i, h := range f {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	out := make(fanout, len(f))
+	for i, h := range f {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
+
+// attrSet holds the attributes and group prefix added through WithAttrs and
+// WithGroup, for handlers that flatten records into key/value fields.
+type attrSet struct {
+	prefix string
+	attrs  []slog.Attr
+}
+
+func (s attrSet) withAttrs(attrs []slog.Attr) attrSet {
+	out := attrSet{prefix: s.prefix, attrs: append(s.attrs[:len(s.attrs):len(s.attrs)], prefixed(s.prefix, attrs)...)}
+	return out
+}
+
+func (s attrSet) withGroup(name string) attrSet {
+	if name == "" {
+		return s
+	}
+	return attrSet{prefix: s.prefix + name + ".", attrs: s.attrs}
+}
+
+func prefixed(prefix string, attrs []slog.Attr) []slog.Attr {
+	if prefix == "" {
+		return attrs
+	}
+	out := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		out[i] = slog.Attr{Key: prefix + a.Key, Value: a.Value}
+	}
+	return out
+}
+
+// each calls fn for every attribute of the set and the record, with groups
+// flattened into dotted keys.
+func (s attrSet) each(r slog.Record, fn func(key string, v slog.Value)) {
+	var walk func(prefix string, a slog.Attr)
+	walk = func(prefix string, a slog.Attr) {
+		v := a.Value.Resolve()
+		if v.Kind() == slog.KindGroup {
+			p := prefix
+			if a.Key != "" {
+				p += a.Key + "."
+			}
+			for _, ga := range v.Group() {
+				walk(p, ga)
+			}
+			return
+		}
+		if a.Key != "" {
+			fn(prefix+a.Key, v)
+		}
+	}
+	for _, a := range s.attrs {
+		walk("", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		walk(s.prefix, a)
+		return true
+	})
+}
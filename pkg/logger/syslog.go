@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"strconv"
+	"strings"
+)
+
+var syslogFacilities = map[string]syslog.Priority{
+	"daemon": syslog.LOG_DAEMON,
+	"user":   syslog.LOG_USER,
+	"local0": syslog.LOG_LOCAL0,
+	"local1": syslog.LOG_LOCAL1,
+	"local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4,
+	"local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6,
+	"local7": syslog.LOG_LOCAL7,
+}
+
+// syslogHandler writes records to the local syslog daemon over its unix
+// socket (/dev/log and friends). Fields are appended to the message as
+// key=value pairs; log/syslog reconnects if the daemon restarts.
+type syslogHandler struct {
+	w   *syslog.Writer
+	set attrSet
+}
+
+func newSyslogHandler(tag, facility string) (*syslogHandler, error) {
+	prio, ok := syslogFacilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	w, err := syslog.New(prio|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogHandler{w: w}, nil
+}
+
+func (h *syslogHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *syslogHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	h.set.each(r, func(key string, v slog.Value) {
+		b.WriteByte(' ')
+		b.WriteString(key)
+		b.WriteByte('=')
+		s := v.String()
+		if s == "" || strings.ContainsAny(s, " \"=\n") {
+			s = strconv.Quote(s)
+		}
+		b.WriteString(s)
+	})
+
+	msg := b.String()
+	switch severity(r.Level) {
+	case 3:
+		return h.w.Err(msg)
+	case 4:
+		return h.w.Warning(msg)
+	case 6:
+		return h.w.Info(msg)
+	default:
+		return h.w.Debug(msg)
+	}
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.set = h.set.withAttrs(attrs)
+	return &c
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.set = h.set.withGroup(name)
+	return &c
+}
+
+func (h *syslogHandler) Close() error {
+	return h.w.Close()
+}